@@ -0,0 +1,133 @@
+package dylive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+type (
+	// GetRoomsOptions are options of GetRooms.
+	GetRoomsOptions struct {
+		Concurrency int  // maximum number of requests at the same time, defaults to 4
+		NoAPI       bool // always fetch full HTML pages instead of trying JSON API first
+	}
+
+	// RoomResult is the result of one Douyin ID in GetRooms.
+	RoomResult struct {
+		Room *Room
+		Err  error
+	}
+
+	dyliveEnter struct {
+		StatusCode int `json:"status_code"`
+		Data       struct {
+			Data    []dyliveRoom `json:"data"`
+			User    dyUser       `json:"user"`
+			Prompts string       `json:"prompts"`
+		} `json:"data"`
+	}
+)
+
+// GetRooms gets live stream rooms of many Douyin IDs concurrently. Duplicate
+// IDs are only fetched once. The returned map has result of every ID, with
+// RoomStatusError if the room does not exist or is banned.
+func GetRooms(ctx context.Context, douyinIds []string, opts *GetRoomsOptions) map[string]RoomResult {
+	if opts == nil {
+		opts = &GetRoomsOptions{}
+	}
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 4
+	}
+	results := map[string]RoomResult{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	seen := map[string]bool{}
+	for _, id := range douyinIds {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				mu.Lock()
+				results[id] = RoomResult{Err: ctx.Err()}
+				mu.Unlock()
+				return
+			}
+			defer func() { <-sem }()
+			var room *Room
+			var err error
+			if !opts.NoAPI {
+				room, err = getRoomFromAPI(ctx, id)
+			}
+			var statusErr *RoomStatusError
+			if opts.NoAPI || (err != nil && ctx.Err() == nil && !errors.As(err, &statusErr)) {
+				room, err = GetRoom(ctx, id)
+			}
+			mu.Lock()
+			results[id] = RoomResult{Room: room, Err: err}
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return results
+}
+
+// getRoomFromAPI gets room from the JSON API used by the live page, which is
+// much smaller than the page itself.
+func getRoomFromAPI(ctx context.Context, douyinId string) (*Room, error) {
+	query := url.Values{
+		"aid":              {"6383"},
+		"app_name":         {"douyin_web"},
+		"live_id":          {"1"},
+		"device_platform":  {"web"},
+		"language":         {"zh-CN"},
+		"browser_language": {"zh-CN"},
+		"browser_platform": {"Win32"},
+		"browser_name":     {"Firefox"},
+		"browser_version":  {"115.0"},
+		"web_rid":          {douyinId},
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://live.douyin.com/webcast/room/web/enter/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Referer", "https://live.douyin.com/"+douyinId)
+	if err := DefaultSession.prepare(ctx, req); err != nil {
+		return nil, err
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	DefaultSession.update(resp)
+	var enter dyliveEnter
+	if err := json.NewDecoder(resp.Body).Decode(&enter); err != nil {
+		return nil, err
+	}
+	if enter.StatusCode != 0 {
+		return nil, fmt.Errorf("room API of DouyinId %s responded with status code %d", douyinId, enter.StatusCode)
+	}
+	if len(enter.Data.Data) == 0 || enter.Data.Data[0].IdStr == "" {
+		return nil, missingRoomError(douyinId, enter.Data.Prompts)
+	}
+	info := dyliveRoomInfo{
+		Room:   enter.Data.Data[0],
+		WebRid: douyinId,
+		Anchor: enter.Data.User,
+	}
+	return info.room(), nil
+}
@@ -0,0 +1,98 @@
+package dylive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchRooms(t *testing.T) {
+	var count, handshakes, noCookies, running, maxRunning int32
+	defer func(s *Session) { DefaultSession = s }(DefaultSession)
+	DefaultSession = &Session{}
+	defer func(c *http.Client) { HTTPClient = c }(HTTPClient)
+	HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if !strings.HasPrefix(req.URL.Path, "/webcast/") {
+			if req.URL.Path == "/" {
+				atomic.AddInt32(&handshakes, 1)
+			}
+			header := http.Header{"Set-Cookie": {"__ac_nonce=nonce; Path=/"}}
+			return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+		}
+		if !strings.Contains(req.Header.Get("Cookie"), "__ac_nonce=nonce") {
+			atomic.AddInt32(&noCookies, 1)
+		}
+		atomic.AddInt32(&count, 1)
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		id := req.URL.Query().Get("web_rid")
+		body := `{"status_code":0,"data":{"data":[{"id_str":"room-` + id + `","status":2,"title":"t"}],"user":{"nickname":"` + id + `"}}}`
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})}
+	ids := []string{"a", "b", "a", "c", "d", "e"}
+	results := GetRooms(context.Background(), ids, &GetRoomsOptions{Concurrency: 2})
+	if len(results) != 5 {
+		t.Errorf("should have 5 results instead of %d", len(results))
+	}
+	if count != 5 {
+		t.Errorf("should have made 5 requests instead of %d", count)
+	}
+	if handshakes != 1 {
+		t.Errorf("should have made 1 handshake instead of %d", handshakes)
+	}
+	if noCookies != 0 {
+		t.Errorf("%d requests were made without session cookies", noCookies)
+	}
+	if maxRunning > 2 {
+		t.Errorf("should have made at most 2 requests at the same time instead of %d", maxRunning)
+	}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		r := results[id]
+		if r.Err != nil {
+			t.Error(r.Err)
+			continue
+		}
+		if r.Room.Id != "room-"+id || r.Room.DouyinId != id || r.Room.User.Name != id {
+			t.Errorf("wrong room for %s: %+v", id, r.Room)
+		}
+	}
+}
+
+func TestBatchRoomsMissing(t *testing.T) {
+	defer func(s *Session) { DefaultSession = s }(DefaultSession)
+	DefaultSession = &Session{}
+	defer func(c *http.Client) { HTTPClient = c }(HTTPClient)
+	HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		switch req.URL.Query().Get("web_rid") {
+		case "gone":
+			body = `{"status_code":0,"data":{"data":[]}}`
+		case "banned":
+			body = `{"status_code":0,"data":{"data":[],"prompts":"该直播间已被封禁"}}`
+		}
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})}
+	results := GetRooms(context.Background(), []string{"gone", "banned"}, nil)
+	for id, status := range map[string]RoomStatus{"gone": RoomStatusNotFound, "banned": RoomStatusBanned} {
+		var err *RoomStatusError
+		if !errors.As(results[id].Err, &err) || err.Status != status {
+			t.Errorf("%s should have status %s instead of error %v", id, status, results[id].Err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package dylive
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Reasons of BlockedError, use errors.Is to check them.
+var (
+	ErrBlocked       = errors.New("blocked by Douyin")
+	ErrCaptcha       = errors.New("captcha verification required")
+	ErrAntiBot       = errors.New("anti-bot challenge")
+	ErrLoginRequired = errors.New("login required")
+	ErrRegionBlocked = errors.New("not available in this region")
+)
+
+// BlockedError is returned when Douyin responds with a verification page,
+// login wall or region block instead of the requested data.
+type BlockedError struct {
+	Reason error  // ErrCaptcha, ErrAntiBot, ErrLoginRequired or ErrRegionBlocked
+	Url    string // URL of the blocked request
+	Proxy  string // proxy that served the request, if any
+}
+
+func (e *BlockedError) Error() string {
+	msg := fmt.Sprintf("%s: %s (%s)", ErrBlocked, e.Reason, e.Url)
+	if e.Proxy != "" {
+		msg += " via " + e.Proxy
+	}
+	return msg
+}
+
+func (e *BlockedError) Unwrap() error {
+	return e.Reason
+}
+
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+var blockRules = []struct {
+	reason  error
+	status  int
+	header  string
+	hosts   []string
+	markers []string
+}{
+	{
+		reason:  ErrCaptcha,
+		header:  "X-Vc-Bdturing-Parameters",
+		hosts:   []string{"verify.snssdk.com", "verifycenter"},
+		markers: []string{"验证码中间页", "TTGCaptcha", "secsdk-captcha", "captcha_container", "verify.snssdk.com"},
+	},
+	{
+		reason:  ErrRegionBlocked,
+		status:  http.StatusUnavailableForLegalReasons,
+		markers: []string{"暂不支持当前地区", "当前地区暂不支持", "所在的地区", "not available in your region"},
+	},
+	{
+		reason:  ErrLoginRequired,
+		hosts:   []string{"passport.douyin.com", "sso.douyin.com"},
+		markers: []string{"登录后即可观看", "请登录后", "login-guide-container"},
+	},
+	{
+		reason:  ErrAntiBot,
+		status:  444,
+		markers: []string{"byted_acrawler", "__ac_signature", "_$jsvmprt"},
+	},
+}
+
+// checkBlocked returns BlockedError if the response looks like a
+// verification page, login wall or region block. It should only be used
+// when the data is not found, as pages with data may also contain the
+// markers.
+func checkBlocked(resp *http.Response, body string) error {
+	for _, rule := range blockRules {
+		matched := (rule.status > 0 && resp.StatusCode == rule.status) ||
+			(rule.header != "" && resp.Header.Get(rule.header) != "")
+		if resp.Request != nil {
+			for _, host := range rule.hosts {
+				matched = matched || strings.Contains(resp.Request.URL.Host, host)
+			}
+		}
+		for _, marker := range rule.markers {
+			matched = matched || strings.Contains(body, marker)
+		}
+		if matched {
+			err := &BlockedError{Reason: rule.reason, Proxy: resp.Header.Get(ProxyHeader)}
+			if resp.Request != nil {
+				err.Url = resp.Request.URL.String()
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package dylive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBlocked(t *testing.T) {
+	defer func(s *Session) { DefaultSession = s }(DefaultSession)
+	defer func(c *http.Client) { HTTPClient = c }(HTTPClient)
+	const room = `<script>window.__INIT_PROPS__ = {"roomStore":{"roomInfo":{"web_rid":"abc","room":{"id_str":"1","status":2}}}}</script>`
+	cases := []struct {
+		status int
+		header http.Header
+		body   string
+		reason error
+		pages  int
+	}{
+		{200, http.Header{"X-Vc-Bdturing-Parameters": {"{}"}}, "<html></html>", ErrCaptcha, 1},
+		{200, nil, "<title>验证码中间页</title>", ErrCaptcha, 1},
+		{200, nil, "<script>window.byted_acrawler.init()</script>", ErrAntiBot, 2},
+		{444, nil, "", ErrAntiBot, 2},
+		{451, http.Header{ProxyHeader: {"http://proxy:3128"}}, "", ErrRegionBlocked, 1},
+		{200, nil, "<div>登录后即可观看</div>", ErrLoginRequired, 1},
+		{200, nil, "<div>byted_acrawler</div>" + room, nil, 1},
+	}
+	for _, c := range cases {
+		DefaultSession = &Session{}
+		pages := 0
+		HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/abc" {
+				pages++
+				header := http.Header{}
+				for k, v := range c.header {
+					header[k] = v
+				}
+				return &http.Response{StatusCode: c.status, Header: header, Body: ioutil.NopCloser(strings.NewReader(c.body)), Request: req}, nil
+			}
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+		})}
+		_, err := GetRoom(context.Background(), "abc")
+		if c.reason == nil {
+			if err != nil {
+				t.Errorf("page with data should not be blocked: %s", err)
+			}
+			continue
+		}
+		var blocked *BlockedError
+		if !errors.Is(err, ErrBlocked) || !errors.Is(err, c.reason) || !errors.As(err, &blocked) {
+			t.Errorf("error should be %s instead of %v", c.reason, err)
+		} else if blocked.Url != "https://live.douyin.com/abc" || blocked.Proxy != c.header.Get(ProxyHeader) {
+			t.Errorf("wrong blocked error: %+v", blocked)
+		}
+		if pages != c.pages {
+			t.Errorf("%s: should have requested page %d times instead of %d", c.reason, c.pages, pages)
+		}
+	}
+}
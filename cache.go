@@ -0,0 +1,242 @@
+package dylive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var errNotModified = errors.New("not modified")
+
+type (
+	// Cache caches categories and rooms on disk. When Douyin cannot be
+	// reached, the last fetched data is returned no matter how old it is.
+	Cache struct {
+		Dir           string        // defaults to "dylive" in user cache directory
+		CategoriesTTL time.Duration // defaults to 24 hours
+		RoomsTTL      time.Duration // defaults to 1 minute
+		Provider      Provider      // defaults to Douyin
+
+		// If true, expired data is returned at once and refreshed in
+		// background for next time.
+		StaleWhileRevalidate bool
+
+		// OnError is called when data cannot be fetched and cached data is
+		// returned instead, or when refreshing in background fails.
+		OnError func(key string, err error)
+
+		mu         sync.Mutex
+		refreshing map[string]bool
+	}
+
+	cacheEntry struct {
+		FetchedAt    time.Time       `json:"fetched_at"`
+		ETag         string          `json:"etag,omitempty"`
+		LastModified string          `json:"last_modified,omitempty"`
+		Data         json.RawMessage `json:"data"`
+	}
+
+	validators struct {
+		ETag, LastModified string
+	}
+
+	validatorsKey struct{}
+	noCacheKey    struct{}
+)
+
+// NoCache returns a context that makes Cache fetch data even if cached data
+// has not expired. Cached data is still used if fetching fails.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// GetCategories is like GetCategories but uses cache.
+func (c *Cache) GetCategories(ctx context.Context) (tree CategoryTree, err error) {
+	p := c.provider()
+	err = c.get(ctx, c.key(p, "categories"), c.ttl(c.CategoriesTTL, 24*time.Hour), &tree, func(ctx context.Context) (interface{}, error) {
+		return p.Categories(ctx)
+	})
+	return
+}
+
+// GetRoomsByCategory is like GetRoomsByCategory but uses cache.
+func (c *Cache) GetRoomsByCategory(ctx context.Context, categoryId string) (rooms []Room, err error) {
+	p := c.provider()
+	err = c.get(ctx, c.key(p, "category-"+categoryId), c.ttl(c.RoomsTTL, time.Minute), &rooms, func(ctx context.Context) (interface{}, error) {
+		return p.RoomsByCategory(ctx, categoryId)
+	})
+	return
+}
+
+// GetRoom is like GetRoom but uses cache.
+func (c *Cache) GetRoom(ctx context.Context, douyinId string) (room *Room, err error) {
+	p := c.provider()
+	err = c.get(ctx, c.key(p, "room-"+douyinId), c.ttl(c.RoomsTTL, time.Minute), &room, func(ctx context.Context) (interface{}, error) {
+		return p.Room(ctx, douyinId)
+	})
+	return
+}
+
+func (c *Cache) provider() Provider {
+	if c.Provider != nil {
+		return c.Provider
+	}
+	return Douyin
+}
+
+// key prefixes key with name of provider other than Douyin.
+func (c *Cache) key(p Provider, key string) string {
+	if p.Name() == douyinName {
+		return key
+	}
+	return p.Name() + "-" + key
+}
+
+func (c *Cache) ttl(ttl, def time.Duration) time.Duration {
+	if ttl > 0 {
+		return ttl
+	}
+	return def
+}
+
+func (c *Cache) dir() string {
+	if c.Dir != "" {
+		return c.Dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "dylive")
+}
+
+func (c *Cache) file(key string) string {
+	return filepath.Join(c.dir(), SafeFileName(key)+".json")
+}
+
+func (c *Cache) load(key string) *cacheEntry {
+	b, err := os.ReadFile(c.file(key))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if json.Unmarshal(b, &entry) != nil || len(entry.Data) == 0 {
+		return nil
+	}
+	return &entry
+}
+
+func (c *Cache) save(key string, entry *cacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir(), 0755); err != nil {
+		return err
+	}
+	tmp := c.file(key) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.file(key))
+}
+
+func (c *Cache) get(ctx context.Context, key string, ttl time.Duration, target interface{},
+	fetch func(context.Context) (interface{}, error)) error {
+	entry := c.load(key)
+	noCache, _ := ctx.Value(noCacheKey{}).(bool)
+	if entry != nil && !noCache {
+		if time.Since(entry.FetchedAt) < ttl {
+			return json.Unmarshal(entry.Data, target)
+		}
+		if c.StaleWhileRevalidate {
+			go c.refresh(key, entry, fetch)
+			return json.Unmarshal(entry.Data, target)
+		}
+	}
+	fresh, err := c.revalidate(ctx, key, entry, fetch)
+	if err != nil {
+		if entry == nil {
+			return err
+		}
+		if c.OnError != nil {
+			c.OnError(key, err)
+		}
+		fresh = entry
+	}
+	return json.Unmarshal(fresh.Data, target)
+}
+
+// refresh revalidates entry in background, only once at a time for a key.
+func (c *Cache) refresh(key string, entry *cacheEntry, fetch func(context.Context) (interface{}, error)) {
+	c.mu.Lock()
+	if c.refreshing == nil {
+		c.refreshing = map[string]bool{}
+	}
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.refreshing, key)
+		c.mu.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := c.revalidate(ctx, key, entry, fetch); err != nil && c.OnError != nil {
+		c.OnError(key, err)
+	}
+}
+
+// revalidate fetches data with a conditional request if entry has
+// validators, and saves the result.
+func (c *Cache) revalidate(ctx context.Context, key string, entry *cacheEntry,
+	fetch func(context.Context) (interface{}, error)) (*cacheEntry, error) {
+	v := &validators{}
+	if entry != nil {
+		v.ETag, v.LastModified = entry.ETag, entry.LastModified
+	}
+	data, err := fetch(context.WithValue(ctx, validatorsKey{}, v))
+	if err == errNotModified && entry != nil {
+		entry.FetchedAt = time.Now()
+		c.save(key, entry)
+		return entry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	fresh := &cacheEntry{
+		FetchedAt:    time.Now(),
+		ETag:         v.ETag,
+		LastModified: v.LastModified,
+		Data:         b,
+	}
+	c.save(key, fresh)
+	return fresh, nil
+}
+
+func (v *validators) set(req *http.Request) {
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+func (v *validators) update(resp *http.Response) {
+	v.ETag = resp.Header.Get("ETag")
+	v.LastModified = resp.Header.Get("Last-Modified")
+}
@@ -0,0 +1,96 @@
+package dylive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var mu sync.Mutex
+	var requests, notModified int
+	var offline bool
+	title := "游戏"
+	set := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	defer func(c *http.Client) { HTTPClient = c }(HTTPClient)
+	HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if offline {
+			return nil, errors.New("offline")
+		}
+		requests++
+		header := http.Header{"Etag": {`"` + title + `"`}}
+		if req.Header.Get("If-None-Match") == `"`+title+`"` {
+			notModified++
+			return &http.Response{StatusCode: 304, Header: header, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+		}
+		body := `<script>window.__INIT_PROPS__ = {"categoryData":[{"partition":{"id_str":"101","type":4,"title":"` + title + `"}}]}</script>`
+		return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})}
+
+	var errs []error
+	cache := &Cache{
+		Dir:           t.TempDir(),
+		CategoriesTTL: 50 * time.Millisecond,
+		OnError:       func(key string, err error) { errs = append(errs, err) },
+	}
+	ctx := context.Background()
+	check := func(name string, expectedRequests, expectedNotModified int) {
+		tree, err := cache.GetCategories(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tree) != 1 || tree[0].Name != name {
+			t.Errorf("wrong categories: %v", tree)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if requests != expectedRequests || notModified != expectedNotModified {
+			t.Errorf("should have made %d requests (%d not modified) instead of %d (%d)",
+				expectedRequests, expectedNotModified, requests, notModified)
+		}
+	}
+	check("游戏", 1, 0)
+	check("游戏", 1, 0) // fresh
+	ctx = NoCache(context.Background())
+	check("游戏", 2, 1) // no cache
+	ctx = context.Background()
+	time.Sleep(60 * time.Millisecond)
+	check("游戏", 3, 2) // expired, not modified
+	set(func() { title = "娱乐" })
+	time.Sleep(60 * time.Millisecond)
+	check("娱乐", 4, 2) // expired, modified
+	set(func() { offline = true })
+	time.Sleep(60 * time.Millisecond)
+	check("娱乐", 4, 2) // offline
+	if len(errs) != 1 {
+		t.Errorf("should have 1 error instead of %d", len(errs))
+	}
+	set(func() {
+		offline = false
+		title = "知识"
+	})
+	cache.StaleWhileRevalidate = true
+	time.Sleep(60 * time.Millisecond)
+	// stale, the background refresh may finish before requests are counted
+	if tree, err := cache.GetCategories(ctx); err != nil || len(tree) != 1 || tree[0].Name != "娱乐" {
+		t.Errorf("should get stale categories instead of %v: %v", tree, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	set(func() {
+		if requests != 5 {
+			t.Errorf("should have refreshed in background")
+		}
+	})
+	check("知识", 5, 2)
+}
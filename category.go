@@ -0,0 +1,140 @@
+package dylive
+
+// CategoryTree is a list of top-level categories and their sub categories.
+type CategoryTree []Category
+
+// CategoryDiff is the difference between two category trees.
+type CategoryDiff struct {
+	Added   []Category
+	Removed []Category
+	Renamed []CategoryRename
+}
+
+// CategoryRename is a category whose name has changed.
+type CategoryRename struct {
+	Old, New Category
+}
+
+// Walk calls fn for every category in depth-first order. Sub categories of a
+// category are skipped if fn returns false.
+func (tree CategoryTree) Walk(fn func(cat *Category, depth int) bool) {
+	walkCategories(tree, 0, fn)
+}
+
+func walkCategories(cats []Category, depth int, fn func(*Category, int) bool) {
+	for i := range cats {
+		if fn(&cats[i], depth) {
+			walkCategories(cats[i].Categories, depth+1, fn)
+		}
+	}
+}
+
+// FindByID returns the category with the id or nil if not found.
+func (tree CategoryTree) FindByID(id string) *Category {
+	var found *Category
+	tree.Walk(func(cat *Category, depth int) bool {
+		if found == nil && cat.Id == id {
+			found = cat
+		}
+		return found == nil
+	})
+	return found
+}
+
+// FindByName returns the first category with the name in depth-first order
+// or nil if not found.
+func (tree CategoryTree) FindByName(name string) *Category {
+	var found *Category
+	tree.Walk(func(cat *Category, depth int) bool {
+		if found == nil && cat.Name == name {
+			found = cat
+		}
+		return found == nil
+	})
+	return found
+}
+
+// Path returns the category with the id and all its parent categories,
+// starting from the top-level category. It returns nil if not found.
+func (tree CategoryTree) Path(id string) []Category {
+	for _, cat := range tree {
+		if cat.Id == id {
+			return []Category{cat}
+		}
+		if path := CategoryTree(cat.Categories).Path(id); path != nil {
+			return append([]Category{cat}, path...)
+		}
+	}
+	return nil
+}
+
+// Flatten returns all categories in depth-first order.
+func (tree CategoryTree) Flatten() (cats []Category) {
+	tree.Walk(func(cat *Category, depth int) bool {
+		cats = append(cats, *cat)
+		return true
+	})
+	return
+}
+
+// Leaves returns all categories that do not have sub categories.
+func (tree CategoryTree) Leaves() (cats []Category) {
+	tree.Walk(func(cat *Category, depth int) bool {
+		if len(cat.Categories) == 0 {
+			cats = append(cats, *cat)
+		}
+		return true
+	})
+	return
+}
+
+// Promote returns a new tree whose top-level categories are the sub
+// categories of the category with the name, followed by a category named
+// others that contains the rest of the top-level categories. The tree is
+// returned unchanged if there is no such category.
+func (tree CategoryTree) Promote(name, others string) CategoryTree {
+	idx := -1
+	for i, c := range tree {
+		if c.Name == name {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return tree
+	}
+	rest := make([]Category, 0, len(tree)-1)
+	rest = append(rest, tree[:idx]...)
+	rest = append(rest, tree[idx+1:]...)
+	newTree := make(CategoryTree, 0, len(tree[idx].Categories)+1)
+	newTree = append(newTree, tree[idx].Categories...)
+	newTree = append(newTree, Category{
+		Name:       others,
+		Categories: rest,
+	})
+	return newTree
+}
+
+// Diff compares tree with a newer tree by category ID.
+func (tree CategoryTree) Diff(newer CategoryTree) (diff CategoryDiff) {
+	olds := map[string]Category{}
+	for _, cat := range tree.Flatten() {
+		olds[cat.Id] = cat
+	}
+	news := map[string]bool{}
+	for _, cat := range newer.Flatten() {
+		news[cat.Id] = true
+		old, ok := olds[cat.Id]
+		if !ok {
+			diff.Added = append(diff.Added, cat)
+		} else if old.Name != cat.Name {
+			diff.Renamed = append(diff.Renamed, CategoryRename{Old: old, New: cat})
+		}
+	}
+	for _, cat := range tree.Flatten() {
+		if !news[cat.Id] {
+			diff.Removed = append(diff.Removed, cat)
+		}
+	}
+	return
+}
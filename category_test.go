@@ -0,0 +1,107 @@
+package dylive
+
+import (
+	"testing"
+)
+
+func testCategoryTree() CategoryTree {
+	return CategoryTree{
+		{Id: "1", Name: "游戏", Categories: []Category{
+			{Id: "1_1", Name: "射击", Categories: []Category{
+				{Id: "1_1_1", Name: "和平精英"},
+			}},
+			{Id: "1_2", Name: "棋牌"},
+		}},
+		{Id: "2", Name: "娱乐", Categories: []Category{
+			{Id: "2_1", Name: "聊天"},
+		}},
+	}
+}
+
+func categoryIds(cats []Category) (ids []string) {
+	for _, c := range cats {
+		ids = append(ids, c.Id)
+	}
+	return
+}
+
+func sameIds(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCategoryTreeFind(t *testing.T) {
+	tree := testCategoryTree()
+	if cat := tree.FindByID("1_1_1"); cat == nil || cat.Name != "和平精英" {
+		t.Errorf("wrong category: %v", cat)
+	}
+	if cat := tree.FindByID("3"); cat != nil {
+		t.Errorf("should not find category: %v", cat)
+	}
+	tree.FindByID("1_1_1").Name = "renamed"
+	if cat := tree.FindByName("renamed"); cat == nil || cat.Id != "1_1_1" {
+		t.Errorf("FindByID should return category in the tree: %v", cat)
+	}
+	if cat := tree.FindByName("聊天"); cat == nil || cat.Id != "2_1" {
+		t.Errorf("wrong category: %v", cat)
+	}
+	if ids := categoryIds(tree.Path("1_1_1")); !sameIds(ids, []string{"1", "1_1", "1_1_1"}) {
+		t.Errorf("wrong path: %v", ids)
+	}
+}
+
+func TestCategoryTreeFlatten(t *testing.T) {
+	tree := testCategoryTree()
+	if ids := categoryIds(tree.Flatten()); !sameIds(ids, []string{"1", "1_1", "1_1_1", "1_2", "2", "2_1"}) {
+		t.Errorf("wrong flatten: %v", ids)
+	}
+	if ids := categoryIds(tree.Leaves()); !sameIds(ids, []string{"1_1_1", "1_2", "2_1"}) {
+		t.Errorf("wrong leaves: %v", ids)
+	}
+	var depths []int
+	tree.Walk(func(cat *Category, depth int) bool {
+		depths = append(depths, depth)
+		return cat.Id != "1"
+	})
+	if len(depths) != 3 || depths[0] != 0 || depths[1] != 0 || depths[2] != 1 {
+		t.Errorf("wrong walk: %v", depths)
+	}
+}
+
+func TestCategoryTreePromote(t *testing.T) {
+	tree := testCategoryTree().Promote("游戏", "其他")
+	if len(tree) != 3 || tree[0].Id != "1_1" || tree[1].Id != "1_2" || tree[2].Name != "其他" {
+		t.Errorf("wrong tree: %v", tree)
+	}
+	if ids := categoryIds(tree[2].Categories); !sameIds(ids, []string{"2"}) {
+		t.Errorf("wrong others: %v", ids)
+	}
+	if len(testCategoryTree().Promote("x", "其他")) != 2 {
+		t.Error("tree should not change")
+	}
+}
+
+func TestCategoryTreeDiff(t *testing.T) {
+	old := testCategoryTree()
+	newer := testCategoryTree()
+	newer[0].Categories = newer[0].Categories[:1]
+	newer[1].Name = "娱乐天地"
+	newer = append(newer, Category{Id: "3", Name: "知识"})
+	diff := old.Diff(newer)
+	if ids := categoryIds(diff.Added); !sameIds(ids, []string{"3"}) {
+		t.Errorf("wrong added: %v", ids)
+	}
+	if ids := categoryIds(diff.Removed); !sameIds(ids, []string{"1_2"}) {
+		t.Errorf("wrong removed: %v", ids)
+	}
+	if len(diff.Renamed) != 1 || diff.Renamed[0].Old.Name != "娱乐" || diff.Renamed[0].New.Name != "娱乐天地" {
+		t.Errorf("wrong renamed: %v", diff.Renamed)
+	}
+}
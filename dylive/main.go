@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
@@ -15,7 +14,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"text/template"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -42,10 +41,11 @@ var (
 	paneRoomsShowRoomName bool
 	paneRoomsX            int
 
-	categories []dylive.Category
+	categories dylive.CategoryTree
 	rooms      []dylive.Room
 
 	selectedRooms selections
+	probes        = map[string]*probe{} // by User.Key()
 
 	lastEnterWithAlt bool
 	lastMouseClick   time.Time
@@ -55,14 +55,22 @@ var (
 	currentHelp   int = -1
 	currentConfig config
 	preferQuality string
+	relayUrl      string
 
 	color      = "lightgreen"
 	isWindows  = runtime.GOOS == "windows"
 	borderless = isWindows
-	timeFormat = "2006-01-02-15-04-05"
+	timeFormat = dylive.DefaultTimeFormat
 
 	statusChan = make(chan status)
 
+	cache = &dylive.Cache{
+		StaleWhileRevalidate: true,
+		OnError: func(key string, err error) {
+			go updateStatus("网络错误，显示缓存数据："+err.Error(), 0)
+		},
+	}
+
 	helps = [][]string{
 		{"(Shift)+Tab", "切换主分类"},
 		{"Alt+Up/Down/PgUp/PgDn", "切换子分类"},
@@ -74,6 +82,8 @@ var (
 		{"Ctrl+(Alt)+E", "编辑器中查看信息"},
 		{"Ctrl-S", "编辑器中查看命令"},
 		{"Ctrl+(Alt)+R", "重新加载"},
+		{"Ctrl+P", "检测直播流"},
+		{"Ctrl+O", "保存最近回放"},
 	}
 )
 
@@ -82,6 +92,12 @@ const (
 	extraKeys = `!@#$%^&*()-=[]\;',./_+{}|:"<>`
 )
 
+type probe struct {
+	result *dylive.ProbeResult
+	err    error
+	done   bool
+}
+
 type config struct {
 	DefaultCategory    string
 	DefaultSubCategory string
@@ -95,6 +111,10 @@ func main() {
 	configFile := flag.String("c", defaultConfigFile, "config file location")
 	noMouse := flag.Bool("no-mouse", false, "disable mouse")
 	flag.StringVar(&preferQuality, "q", "hd", "video quality (uhd, hd, ld, sd)")
+	flag.StringVar(&dylive.DefaultSession.CookieFile, "cookies", "", "cookie file in Netscape format, for example exported from browser")
+	flag.DurationVar(&replayDuration, "replay", 0, "keep last minutes of streams opened in player, for example 2m; press Ctrl+O to save")
+	flag.StringVar(&relayUrl, "relay", "", "open streams from dyrelay at this URL, for example http://127.0.0.1:8090; quality is set by dyrelay and -q is ignored")
+	providerName := flag.String("p", "douyin", "live stream provider ("+strings.Join(dylive.Providers(), ", ")+")")
 	flag.Usage = func() {
 		o := flag.CommandLine.Output()
 		fmt.Fprintln(o, "Usage:", filepath.Base(os.Args[0]), "[options] -- [player arguments]")
@@ -115,6 +135,13 @@ func main() {
 	}
 	flag.Parse()
 
+	provider, ok := dylive.LookupProvider(*providerName)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown provider:", *providerName)
+		os.Exit(1)
+	}
+	cache.Provider = provider
+
 	if c := os.Getenv("COLOR"); c != "" {
 		color = c
 	}
@@ -165,7 +192,7 @@ func main() {
 
 	reset()
 
-	go getCategories()
+	go getCategories(false)
 
 	pages = tview.NewPages()
 	pages.AddPage("grid", grid, true, true)
@@ -244,41 +271,19 @@ func createCategories() {
 	})
 }
 
-func getCategories() {
+func getCategories(reload bool) {
 	go updateStatus("正在获取分类…", 0)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	var err error
-	categories, err = dylive.GetCategories(ctx)
+	if reload {
+		ctx = dylive.NoCache(ctx)
+	}
+	tree, err := cache.GetCategories(ctx)
 	if err != nil {
 		go showError(err)
 		return
 	}
-
-	gameIdx := -1
-	for i, c := range categories {
-		if c.Name == "游戏" {
-			gameIdx = i
-			break
-		}
-	}
-	if gameIdx != -1 {
-		game := categories[gameIdx]
-		others := make([]dylive.Category, 0, len(categories)-1)
-		for i, c := range categories {
-			if i == gameIdx {
-				continue
-			}
-			others = append(others, c)
-		}
-		newCategories := make([]dylive.Category, 0, len(game.Categories)+1)
-		newCategories = append(newCategories, game.Categories...)
-		newCategories = append(newCategories, dylive.Category{
-			Name:       "其他",
-			Categories: others,
-		})
-		categories = newCategories
-	}
+	categories = tree.Promote("游戏", "其他")
 
 	go updateStatus("成功获取分类", 0)
 	app.QueueUpdateDraw(func() {
@@ -407,7 +412,18 @@ func createRooms() {
 			if row < 0 || row >= len(rooms) {
 				return
 			}
-			go updateStatus(rooms[row].WebUrl, 0)
+			status := rooms[row].WebUrl
+			if age := rooms[row].Age(); age > 0 {
+				status += " · 已开播" + formatAge(age)
+			}
+			if p := probes[rooms[row].User.Key()]; p != nil && p.done {
+				if p.err != nil {
+					status += " · " + p.err.Error()
+				} else {
+					status += " · " + p.result.String()
+				}
+			}
+			go updateStatus(status, 0)
 		}).
 		SetSelectedFunc(func(row, column int) {
 			if len(selectedRooms) > 0 {
@@ -442,7 +458,7 @@ func getRooms() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	var err error
-	rooms, err = dylive.GetRoomsByCategory(ctx, currentSubCat.Id)
+	rooms, err = cache.GetRoomsByCategory(dylive.NoCache(ctx), currentSubCat.Id)
 	if err != nil {
 		go showError(err)
 		return
@@ -467,7 +483,7 @@ func renderRooms() {
 		} else {
 			key = "   "
 		}
-		name := key + " " + room.User.Name
+		name := key + " " + probeMarker(probes[room.User.Key()]) + room.User.Name
 		paneRooms.SetCell(i, 0, tview.NewTableCell(name).SetExpansion(2))
 		paneRooms.SetCell(i, 1, tview.NewTableCell(room.CurrentUsersCount).SetExpansion(2))
 		if paneRoomsShowRoomName {
@@ -584,7 +600,7 @@ func selectRoom(room dylive.Room, nth, total int, noRun bool) *exec.Cmd {
 		}
 	}
 
-	url := room.FlvUrlForQuality(preferQuality)
+	url := streamUrl(room)
 
 	switch cmdType {
 	case "mpv":
@@ -614,32 +630,44 @@ func selectRoom(room dylive.Room, nth, total int, noRun bool) *exec.Cmd {
 	}
 
 	if noRun == false && cmd != nil {
-		cmd.Start()
+		if cmd.Start() == nil && replayDuration > 0 {
+			startReplay(room, cmd, cmdType != "open")
+		}
 	}
 
 	return cmd
 }
 
+// streamUrl returns FLV stream URL of the room, from dyrelay if set.
+func streamUrl(room dylive.Room) string {
+	if u := relayStreamUrl(room); u != "" {
+		return u
+	}
+	return room.FlvUrlForQuality(preferQuality)
+}
+
+// relayStreamUrl returns FLV stream URL of the room from dyrelay, or empty
+// string if dyrelay is not set or the room is not of Douyin.
+func relayStreamUrl(room dylive.Room) string {
+	if relayUrl != "" && room.DouyinId != "" && (room.Provider == "" || room.Provider == dylive.Douyin.Name()) {
+		return strings.TrimSuffix(relayUrl, "/") + "/" + room.DouyinId + ".flv"
+	}
+	return ""
+}
+
 func playerArgs(room dylive.Room, nth, total int) (out []string) {
-	obj := struct {
-		dylive.Room
-		Index int
-		Nth   int
-		Total int
-		Now   string
-	}{room, nth, nth + 1, total, time.Now().Format(timeFormat)}
+	data := dylive.NewTemplateData(room)
+	data.Index = nth
+	data.Nth = nth + 1
+	data.Total = total
+	data.Now = time.Now().Format(timeFormat)
 	for _, arg := range flag.Args() {
-		tpl, err := template.New("").Parse(arg)
+		str, err := data.Execute(arg)
 		if err != nil {
 			out = append(out, arg)
 			continue
 		}
-		var buf bytes.Buffer
-		if tpl.Execute(&buf, obj) != nil {
-			out = append(out, arg)
-			continue
-		}
-		out = append(out, buf.String())
+		out = append(out, str)
 	}
 	return
 }
@@ -736,6 +764,12 @@ func onKeyPressed(event *tcell.EventKey) *tcell.EventKey {
 	case tcell.KeyCtrlA:
 		invertSelection()
 		return nil
+	case tcell.KeyCtrlP:
+		probeRooms()
+		return nil
+	case tcell.KeyCtrlO:
+		saveReplays()
+		return nil
 	case tcell.KeyCtrlR:
 		if event.Modifiers()&tcell.ModAlt != 0 || currentSubCat == nil {
 			forceReload()
@@ -797,9 +831,66 @@ func onKeyPressed(event *tcell.EventKey) *tcell.EventKey {
 	return event
 }
 
+// probeRooms checks streams of selected rooms, or all rooms if none is
+// selected, and marks rooms with the results.
+func probeRooms() {
+	targets := []dylive.Room(selectedRooms)
+	if len(targets) == 0 {
+		targets = rooms
+	}
+	if len(targets) == 0 {
+		return
+	}
+	for _, room := range targets {
+		probes[room.User.Key()] = &probe{}
+	}
+	renderRooms()
+	go updateStatus(fmt.Sprintf("正在检测 %d 个直播流…", len(targets)), 0)
+	go func() {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var failed int
+		sem := make(chan struct{}, 4)
+		for _, room := range targets {
+			wg.Add(1)
+			go func(room dylive.Room) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				result, err := dylive.Probe(ctx, room.FlvUrlForQuality(preferQuality))
+				if err != nil {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+				app.QueueUpdateDraw(func() {
+					probes[room.User.Key()] = &probe{result: result, err: err, done: true}
+					renderRooms()
+				})
+			}(room)
+		}
+		wg.Wait()
+		updateStatus(fmt.Sprintf("检测完成：%d 个正常，%d 个失败", len(targets)-failed, failed), 0)
+	}()
+}
+
+func probeMarker(p *probe) string {
+	switch {
+	case p == nil:
+		return ""
+	case !p.done:
+		return "[yellow]…[white] "
+	case p.err != nil:
+		return "[red]✗[white] "
+	}
+	return "[green]●[white] "
+}
+
 func forceReload() {
 	reset()
-	go getCategories()
+	go getCategories(true)
 }
 
 func showError(err error) {
@@ -935,6 +1026,14 @@ func updateStatus(text string, wait time.Duration) {
 	statusChan <- status{text: text, wait: wait}
 }
 
+func formatAge(age time.Duration) string {
+	age = age.Truncate(time.Minute)
+	if age < time.Hour {
+		return fmt.Sprintf("%d分钟", int(age.Minutes()))
+	}
+	return fmt.Sprintf("%d小时%d分钟", int(age.Hours()), int(age.Minutes())%60)
+}
+
 func exists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
@@ -959,7 +1058,7 @@ func (s *selections) toggle(i dylive.Room) {
 	if s.has(i) {
 		n := selections{}
 		for _, a := range *s {
-			if a.User.Name != i.User.Name {
+			if a.User.Key() != i.User.Key() {
 				n = append(n, a)
 			}
 		}
@@ -971,7 +1070,7 @@ func (s *selections) toggle(i dylive.Room) {
 
 func (s selections) has(i dylive.Room) bool {
 	for _, a := range s {
-		if a.User.Name == i.User.Name {
+		if a.User.Key() == i.User.Key() {
 			return true
 		}
 	}
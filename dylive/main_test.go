@@ -2,6 +2,9 @@ package main
 
 import (
 	"testing"
+	"time"
+
+	"github.com/caiguanhao/dylive"
 )
 
 func Test_arrange(t *testing.T) {
@@ -61,3 +64,31 @@ func Test_mpvGeometry(t *testing.T) {
 		}
 	}
 }
+
+func Test_formatAge(t *testing.T) {
+	cases := map[time.Duration]string{
+		90 * time.Second:                "1分钟",
+		2*time.Hour + 5*time.Minute + 9: "2小时5分钟",
+	}
+	for age, expected := range cases {
+		if actual := formatAge(age); actual != expected {
+			t.Errorf("formatAge(%s) should be %s instead of %s", age, expected, actual)
+		}
+	}
+}
+
+func Test_streamUrl(t *testing.T) {
+	defer func(u string) { relayUrl = u }(relayUrl)
+	room := dylive.Room{DouyinId: "abc", StreamUrl: "http://example.com/abc.flv"}
+	if u := streamUrl(room); u != room.StreamUrl {
+		t.Errorf("should use stream of room without relay instead of %s", u)
+	}
+	relayUrl = "http://127.0.0.1:8090/"
+	if u := streamUrl(room); u != "http://127.0.0.1:8090/abc.flv" {
+		t.Errorf("should use stream of relay instead of %s", u)
+	}
+	room.Provider = "other"
+	if u := relayStreamUrl(room); u != "" {
+		t.Errorf("should not relay room of other provider: %s", u)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiguanhao/dylive"
+)
+
+var (
+	replayDuration time.Duration
+	replayMu       sync.Mutex
+	replays        = map[string]*dylive.ReplayBuffer{} // by User.Key()
+)
+
+// startReplay buffers the last minutes of the stream of the room opened in
+// player, from dyrelay if set, until the room is no longer live or, if wait
+// is true, the player exits.
+func startReplay(room dylive.Room, cmd *exec.Cmd, wait bool) {
+	key := room.User.Key()
+	replayMu.Lock()
+	if _, ok := replays[key]; ok {
+		replayMu.Unlock()
+		return
+	}
+	b := &dylive.ReplayBuffer{Duration: replayDuration, Room: &room}
+	replays[key] = b
+	replayMu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if wait && cmd != nil && cmd.Process != nil {
+		go func() {
+			cmd.Wait()
+			cancel()
+		}()
+	}
+	getRoom := dylive.GetRoom
+	if provider, ok := dylive.LookupProvider(room.Provider); ok {
+		getRoom = provider.Room
+	}
+	if u := relayStreamUrl(room); u != "" {
+		// share the connection of dyrelay with the player
+		roomOf := getRoom
+		getRoom = func(ctx context.Context, douyinId string) (*dylive.Room, error) {
+			room, err := roomOf(ctx, douyinId)
+			if err != nil {
+				return nil, err
+			}
+			room.StreamUrl, room.FlvStreamUrls = u, nil
+			return room, nil
+		}
+	}
+	src := &dylive.StreamSource{
+		DouyinId: room.DouyinId,
+		Quality:  preferQuality,
+		GetRoom:  getRoom,
+	}
+	go func() {
+		defer cancel()
+		defer func() {
+			replayMu.Lock()
+			delete(replays, key)
+			replayMu.Unlock()
+		}()
+		r, err := src.Open(ctx)
+		if err != nil {
+			return
+		}
+		defer r.Close()
+		b.Run(ctx, r)
+	}()
+}
+
+// saveReplays saves buffers of selected rooms, or the current room if none
+// is selected, to the current directory.
+func saveReplays() {
+	targets := []dylive.Room(selectedRooms)
+	if len(targets) == 0 {
+		if row, _ := paneRooms.GetSelection(); row >= 0 && row < len(rooms) {
+			targets = []dylive.Room{rooms[row]}
+		}
+	}
+	var buffers []*dylive.ReplayBuffer
+	replayMu.Lock()
+	for _, room := range targets {
+		if b, ok := replays[room.User.Key()]; ok {
+			buffers = append(buffers, b)
+		}
+	}
+	replayMu.Unlock()
+	if len(buffers) == 0 {
+		go updateStatus("没有正在缓存的回放，请先在播放器中打开", 0)
+		return
+	}
+	go func() {
+		now := time.Now().Format("20060102-150405")
+		var saved []string
+		for _, b := range buffers {
+			name := dylive.SafeFileName(b.Room.User.Name) + "-" + now + ".flv"
+			clip, err := b.SaveFile(name)
+			if err != nil {
+				updateStatus("保存回放失败："+err.Error(), 0)
+				return
+			}
+			saved = append(saved, fmt.Sprintf("%s（%.0f秒）", clip.File, clip.Duration))
+		}
+		updateStatus(fmt.Sprintf("已保存 %d 个回放：%s", len(saved), strings.Join(saved, "，")), 0)
+	}()
+}
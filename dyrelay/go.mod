@@ -0,0 +1,5 @@
+module github.com/caiguanhao/dylive/dyrelay
+
+go 1.17
+
+require github.com/caiguanhao/dylive v1.2.3
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/caiguanhao/dylive"
+)
+
+func main() {
+	relay := &dylive.Relay{}
+	listen := flag.String("listen", "127.0.0.1:8090", "address to listen on")
+	flag.StringVar(&relay.Quality, "q", "", "video quality (uhd, hd, ld, sd)")
+	flag.DurationVar(&relay.IdleTimeout, "idle", 30*time.Second, "close upstream stream after no clients for this long")
+	flag.StringVar(&dylive.DefaultSession.CookieFile, "cookies", "", "cookie file in Netscape format, for example exported from browser")
+	flag.Usage = func() {
+		o := flag.CommandLine.Output()
+		fmt.Fprintln(o, "Relay live streams from Douyin to local clients.")
+		fmt.Fprintln(o)
+		fmt.Fprintf(o, "Usage of %s: [options]\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(o)
+		fmt.Fprintln(o, "URLs:")
+		fmt.Fprintln(o, "  /<Douyin ID>.flv       - FLV stream, starting at the latest keyframe")
+		fmt.Fprintln(o, "  /<Douyin ID>.m3u8      - HLS playlist")
+	}
+	flag.Parse()
+	log.Println("Relay listening on", *listen)
+	log.Fatal(http.ListenAndServe(*listen, relay))
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/caiguanhao/dylive"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+type (
+	// streamer is the state of one watched Douyin ID shown on the dashboard.
+	streamer struct {
+		DouyinId  string     `json:"douyin_id"`
+		Name      string     `json:"name"`
+		Picture   string     `json:"picture"`
+		Live      bool       `json:"live"`
+		Status    string     `json:"status"`
+		Title     string     `json:"title"`
+		Viewers   string     `json:"viewers"`
+		WebUrl    string     `json:"web_url"`
+		LiveSince *time.Time `json:"live_since,omitempty"`
+		Recording bool       `json:"recording"`
+		Error     string     `json:"error,omitempty"`
+		UpdatedAt time.Time  `json:"updated_at"`
+	}
+
+	dashboard struct {
+		sync.Mutex
+		ids       []string
+		streamers map[string]*streamer
+		clients   map[chan []byte]bool
+	}
+)
+
+var dash = &dashboard{
+	streamers: map[string]*streamer{},
+	clients:   map[chan []byte]bool{},
+}
+
+// update records the result of one poll of a Douyin ID.
+func (d *dashboard) update(id string, room *dylive.Room, err error) {
+	d.Lock()
+	defer d.Unlock()
+	s, ok := d.streamers[id]
+	if !ok {
+		s = &streamer{DouyinId: id}
+		d.streamers[id] = s
+		d.ids = append(d.ids, id)
+	}
+	s.UpdatedAt = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+		var statusErr *dylive.RoomStatusError
+		if errors.As(err, &statusErr) {
+			s.Status = statusErr.Status.String()
+			s.Live, s.LiveSince, s.Recording = false, nil, false
+		}
+		return
+	}
+	s.Error = ""
+	if room.IsOnAir() && !room.StartedAt.IsZero() {
+		since := room.StartedAt
+		s.LiveSince = &since
+	} else if room.IsOnAir() && s.LiveSince == nil {
+		since := s.UpdatedAt
+		s.LiveSince = &since
+	} else if !room.IsOnAir() {
+		s.LiveSince = nil
+	}
+	live := room.IsLive()
+	s.Live = live
+	s.Status = room.StatusCode.String()
+	s.Name = room.User.Name
+	s.Picture = room.User.Picture
+	s.Title = room.Name
+	s.Viewers = room.CurrentUsersCount
+	s.WebUrl = room.WebUrl
+	s.Recording = live && isRecording(room)
+}
+
+// isRecording reports whether the stream of the room is being captured by
+// the command of -run or -exec, pushed by -rtmp or saved by -record.
+func isRecording(room *dylive.Room) bool {
+	if pid := pids[room.Id]; pid > 0 && isProcessRunning(pid) {
+		return true
+	}
+	publishMu.Lock()
+	pushing := publishing[room.Id]
+	publishMu.Unlock()
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	return pushing || recording[room.Id]
+}
+
+func (d *dashboard) snapshot() []byte {
+	d.Lock()
+	defer d.Unlock()
+	list := make([]streamer, 0, len(d.ids))
+	for _, id := range d.ids {
+		list = append(list, *d.streamers[id])
+	}
+	b, _ := json.Marshal(list)
+	return b
+}
+
+// broadcast sends current state to all connected event streams.
+func (d *dashboard) broadcast() {
+	data := d.snapshot()
+	d.Lock()
+	defer d.Unlock()
+	for c := range d.clients {
+		select {
+		case c <- data:
+		default: // slow client, it will get next update
+		}
+	}
+}
+
+func (d *dashboard) subscribe() chan []byte {
+	c := make(chan []byte, 1)
+	d.Lock()
+	d.clients[c] = true
+	d.Unlock()
+	return c
+}
+
+func (d *dashboard) unsubscribe(c chan []byte) {
+	d.Lock()
+	delete(d.clients, c)
+	d.Unlock()
+}
+
+func (d *dashboard) serveStreamers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(d.snapshot())
+}
+
+func serveProxies(w http.ResponseWriter, r *http.Request) {
+	stats := []dylive.ProxyStats{}
+	if proxyPool != nil {
+		stats = proxyPool.Stats()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func (d *dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	c := d.subscribe()
+	defer d.unsubscribe(c)
+	fmt.Fprintf(w, "data: %s\n\n", d.snapshot())
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-c:
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+func serveDashboard(addr string) {
+	static, _ := fs.Sub(dashboardFiles, "dashboard")
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	mux.HandleFunc("/streamers", dash.serveStreamers)
+	mux.HandleFunc("/events", dash.serveEvents)
+	mux.HandleFunc("/proxies", serveProxies)
+	log.Println("Dashboard listening on", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caiguanhao/dylive"
+)
+
+func newTestDashboard() *dashboard {
+	return &dashboard{
+		streamers: map[string]*streamer{},
+		clients:   map[chan []byte]bool{},
+	}
+}
+
+func Test_dashboardUpdate(t *testing.T) {
+	d := newTestDashboard()
+	started := time.Date(2022, 1, 1, 20, 0, 0, 0, time.UTC)
+	room := &dylive.Room{
+		Id:         "1",
+		Name:       "title",
+		StatusCode: dylive.RoomStatusLiveOn,
+		StartedAt:  started,
+		User:       dylive.User{Name: "name"},
+	}
+	d.update("b", room, nil)
+	d.update("a", nil, errors.New("failed"))
+
+	var list []streamer
+	if err := json.Unmarshal(d.snapshot(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].DouyinId != "b" || list[1].DouyinId != "a" {
+		t.Fatalf("streamers should be in order of first update: %+v", list)
+	}
+	b := list[0]
+	if !b.Live || b.Status != "live" || b.Name != "name" || b.Title != "title" || b.LiveSince == nil || !b.LiveSince.Equal(started) {
+		t.Errorf("wrong streamer %+v", b)
+	}
+	if list[1].Error != "failed" || list[1].Live {
+		t.Errorf("wrong streamer %+v", list[1])
+	}
+
+	if list[0].Recording {
+		t.Error("streamer should not be recording")
+	}
+	publishMu.Lock()
+	publishing["1"] = true
+	publishMu.Unlock()
+	d.update("b", room, nil)
+	publishMu.Lock()
+	delete(publishing, "1")
+	publishMu.Unlock()
+	if !d.streamers["b"].Recording {
+		t.Error("streamer pushed by -rtmp should be recording")
+	}
+	recordMu.Lock()
+	recording["1"] = true
+	recordMu.Unlock()
+	d.update("b", room, nil)
+	recordMu.Lock()
+	delete(recording, "1")
+	recordMu.Unlock()
+	if !d.streamers["b"].Recording {
+		t.Error("streamer saved by -record should be recording")
+	}
+
+	// errors keep last known state
+	d.update("b", nil, errors.New("timeout"))
+	if s := d.streamers["b"]; !s.Live || s.Error != "timeout" {
+		t.Errorf("wrong streamer %+v", s)
+	}
+
+	room.StatusCode = dylive.RoomStatusLiveOff
+	d.update("b", room, nil)
+	if s := d.streamers["b"]; s.Live || s.LiveSince != nil || s.Error != "" || s.Status != "ended" {
+		t.Errorf("wrong streamer %+v", s)
+	}
+
+	d.update("b", nil, fmt.Errorf("get room: %w", &dylive.RoomStatusError{DouyinId: "b", Status: dylive.RoomStatusBanned}))
+	if s := d.streamers["b"]; s.Live || s.Status != "banned" || s.Error == "" {
+		t.Errorf("wrong streamer %+v", s)
+	}
+}
+
+func Test_dashboardEvents(t *testing.T) {
+	d := newTestDashboard()
+	d.update("a", &dylive.Room{StatusCode: dylive.RoomStatusPreparing}, nil)
+	server := httptest.NewServer(http.HandlerFunc(d.serveEvents))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("wrong content type %s", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+	next := func() []streamer {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data := strings.TrimPrefix(line, "data: "); data != line {
+				var list []streamer
+				if err := json.Unmarshal([]byte(data), &list); err != nil {
+					t.Fatal(err)
+				}
+				return list
+			}
+		}
+	}
+	if list := next(); len(list) != 1 || list[0].Status != "preparing" {
+		t.Errorf("first event should be current state: %+v", list)
+	}
+
+	d.update("a", &dylive.Room{StatusCode: dylive.RoomStatusLiveOn}, nil)
+	d.broadcast()
+	if list := next(); len(list) != 1 || !list[0].Live {
+		t.Errorf("event should be sent on broadcast: %+v", list)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -10,7 +11,6 @@ import (
 	"os/exec"
 	"strings"
 	"syscall"
-	"text/template"
 	"time"
 
 	"github.com/caiguanhao/dylive"
@@ -19,30 +19,145 @@ import (
 var (
 	currentRooms = map[string]string{}
 	pids         = map[string]int{}
+	pausedRooms  = map[string]string{}
+	nextPolls    = map[string]time.Time{}
+	failures     = map[string]int{}
+	resolved     = map[string]string{}
+	schedules    = map[string]schedule{}
+	learned      *history
+	proxyPool    *dylive.ProxyPool
+	blockedUntil time.Time
+	blocks       int
 
 	preferQuality, preferFormat string
+	preferCodec                 string
 	outputJson                  bool
 	commadnTemplate             string
+	execTemplate                string
+	rtmpTemplate                string
+	recordTemplate              string
 	checkCommand                bool
+	httpAddr                    string
+	interval, idleInterval      time.Duration
 )
 
 func main() {
 	flag.StringVar(&preferQuality, "q", "", "video quality (uhd, hd, ld, sd)")
 	flag.StringVar(&preferFormat, "f", "flv", "format (flv, hls, m3u8)")
+	flag.StringVar(&preferCodec, "codec", "", "only use streams of video codec (h264, h265) if known")
 	flag.BoolVar(&outputJson, "json", false, "output json instead of url")
 	flag.StringVar(&commadnTemplate, "run", "", "command template to run; use @/path/to/template.sh to specify a template file")
+	flag.StringVar(&execTemplate, "exec", "", "command to run without shell, as JSON array of templates, instead of -run; use @/path/to/template.json to\nspecify a template file")
+	flag.StringVar(&rtmpTemplate, "rtmp", "", "RTMP URL template to push live stream to, for example rtmp://10.0.0.5/live/{{.DouyinId}}; pushing\nreconnects and restarts by itself")
+	flag.StringVar(&recordTemplate, "record", "", "file path template to save live stream to without re-encoding, for example {{safe .User.Name}}/{{.Id}}.flv;\nuse .aac or .m4a extension to save audio only")
 	flag.BoolVar(&checkCommand, "check", false, "re-run command if process does not exist")
+	flag.StringVar(&httpAddr, "http", "", "address to serve web dashboard on, for example :8080")
+	flag.DurationVar(&interval, "interval", 5*time.Second, "polling interval")
+	flag.DurationVar(&idleInterval, "idle-interval", time.Minute, "polling interval outside of scheduled or learned time")
+	scheduleFile := flag.String("schedule", "", "JSON file of watch windows of each Douyin ID, for example\n"+
+		`{"maidanglaodo": {"timezone": "Asia/Shanghai", "windows": ["mon-fri 19:00-23:00"]}}`)
+	proxies := flag.String("proxies", "", "comma separated HTTP or SOCKS5 proxies to rotate requests across, for example\n"+
+		"socks5://127.0.0.1:1080; use @/path/to/proxies.txt to specify a file of one proxy per line")
+	cookieFile := flag.String("cookies", "", "cookie file in Netscape format, for example exported from browser")
+	learnFile := flag.String("learn", "", "JSON file to store history of live stream start times and poll\nfaster around these times of day")
 	flag.Usage = func() {
 		fmt.Fprintln(flag.CommandLine.Output(), "Monitor live streams from Douyin.")
 		fmt.Fprintln(flag.CommandLine.Output())
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s: [options] <Douyin ID, URL or provider:id>...\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
+	if commadnTemplate != "" && execTemplate != "" {
+		log.Fatal("-run and -exec cannot be used together")
+	}
+	for _, id := range flag.Args() {
+		if _, _, err := dylive.ParseProviderID(id); err != nil {
+			log.Fatal(err)
+		}
+	}
+	dylive.DefaultSession.CookieFile = *cookieFile
+	if *proxies != "" {
+		var err error
+		proxyPool, err = dylive.NewProxyPool(strings.FieldsFunc(readTemplate(*proxies), func(r rune) bool {
+			return r == ',' || r == '\n' || r == '\r'
+		}))
+		if err != nil {
+			log.Fatal(err)
+		}
+		dylive.HTTPClient.Transport.(*dylive.Transport).Base = proxyPool
+	}
+	if *scheduleFile != "" {
+		var err error
+		if schedules, err = loadSchedules(*scheduleFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *learnFile != "" {
+		learned = loadHistory(*learnFile)
+	}
+	if httpAddr != "" {
+		go serveDashboard(httpAddr)
+	}
+	if recordTemplate != "" {
+		go finishRecordingsOnSignal()
+	}
 	for {
 		getRoom()
-		time.Sleep(5 * time.Second)
+		dash.broadcast()
+		time.Sleep(interval)
+	}
+}
+
+// failureInterval doubles polling interval after each consecutive failure,
+// up to the idle interval.
+func failureInterval(failures int) time.Duration {
+	max := idleInterval
+	if max < interval {
+		max = interval
+	}
+	d := interval
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// blockedInterval returns how long to pause all requests after Douyin blocks
+// requests, starting from 1 minute and doubling up to 30 minutes.
+func blockedInterval(blocks int) time.Duration {
+	d := time.Minute
+	for i := 1; i < blocks && d < 30*time.Minute; i++ {
+		d *= 2
+	}
+	if d > 30*time.Minute {
+		d = 30 * time.Minute
+	}
+	return d
+}
+
+// pollInterval returns how long to wait before polling the Douyin ID again.
+func pollInterval(id string, onAir bool, now time.Time) time.Duration {
+	if onAir {
+		return interval
+	}
+	s, scheduled := schedules[id]
+	if scheduled && s.contains(now) {
+		return interval
+	}
+	if learned != nil {
+		expected, ok := learned.expects(id, now)
+		if expected || (!ok && !scheduled) {
+			return interval
+		}
+		return idleInterval
+	}
+	if scheduled {
+		return idleInterval
 	}
+	return interval
 }
 
 func getRoom() {
@@ -51,83 +166,212 @@ func getRoom() {
 		log.Println("At least one Douyin ID is required.")
 		os.Exit(1)
 	}
+	if time.Now().Before(blockedUntil) {
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	var batch []string
 	for _, id := range ids {
-		room, err := dylive.GetRoom(ctx, id)
+		if douyinId, ok := resolved[id]; ok && !time.Now().Before(nextPolls[id]) {
+			batch = append(batch, douyinId)
+		}
+	}
+	results := dylive.GetRooms(ctx, batch, nil)
+	for _, id := range ids {
+		now := time.Now()
+		if now.Before(nextPolls[id]) {
+			continue
+		}
+		var room *dylive.Room
+		var err error
+		if result, ok := results[resolved[id]]; ok {
+			room, err = result.Room, result.Err
+		} else {
+			room, err = resolveRoom(ctx, id)
+		}
+		dash.update(id, room, err)
+		var blocked *dylive.BlockedError
+		if errors.As(err, &blocked) && (blocked.Proxy == "" || proxyPool == nil) {
+			// every request would be blocked, so don't poll other IDs either
+			blocks++
+			blockedUntil = now.Add(blockedInterval(blocks))
+			log.Printf("%s, pausing requests until %s", err, blockedUntil.Format("15:04:05"))
+			return
+		}
 		if err != nil {
+			if blocked != nil {
+				proxyPool.Eject(blocked.Proxy)
+			}
+			failures[id]++
+			nextPolls[id] = now.Add(failureInterval(failures[id]))
 			log.Println(err)
 			continue
 		}
+		blocks = 0
+		failures[id] = 0
+		nextPolls[id] = now.Add(pollInterval(id, room.IsOnAir(), now))
 		if currentRooms[id] == room.Id {
-			if checkCommand && room.StatusCode == dylive.RoomStatusLiveOn && pids[room.Id] > 0 && !isProcessRunning(pids[room.Id]) {
+			if rtmpTemplate != "" && room.IsLive() {
+				if err := startPublishing(room); err != nil {
+					log.Println(err)
+				}
+			}
+			if recordTemplate != "" && room.IsLive() {
+				if err := startRecording(room); err != nil {
+					log.Println(err)
+				}
+			}
+			if checkCommand && room.IsLive() && pids[room.Id] > 0 && !isProcessRunning(pids[room.Id]) {
 				log.Println("Process", pids[room.Id], "exited, restart")
 				updateStreamUrl(room)
-				if err := runCommand(commadnTemplate, room); err != nil {
+				if err := runCommand(room); err != nil {
 					log.Println(err)
 				}
 			}
 			continue
 		}
+		if room.IsPaused() {
+			// not marked as current room, so it becomes live when resumed
+			if pausedRooms[id] != room.Id {
+				pausedRooms[id] = room.Id
+				log.Printf("%s (%s) has paused livestream.", room.User.Name, room.DouyinId)
+			}
+			continue
+		}
+		firstPoll := currentRooms[id] == ""
 		currentRooms[id] = room.Id
-		if room.StatusCode != dylive.RoomStatusLiveOn {
+		if !room.IsLive() {
 			log.Printf("%s (%s) hasn't started livestream yet.", room.User.Name, room.DouyinId)
 			continue
 		}
 		log.Printf("%s (%s) is live.", room.User.Name, room.DouyinId)
+		if learned != nil && !firstPoll {
+			learned.add(id, now)
+		}
 		updateStreamUrl(room)
 		if outputJson {
 			json.NewEncoder(os.Stdout).Encode(room)
 		} else {
 			fmt.Println(room.StreamUrl)
 		}
-		if commadnTemplate != "" {
-			if err := runCommand(commadnTemplate, room); err != nil {
+		if commadnTemplate != "" || execTemplate != "" {
+			if err := runCommand(room); err != nil {
+				log.Println(err)
+			}
+		}
+		if rtmpTemplate != "" {
+			if err := startPublishing(room); err != nil {
+				log.Println(err)
+			}
+		}
+		if recordTemplate != "" {
+			if err := startRecording(room); err != nil {
 				log.Println(err)
 			}
 		}
 	}
 }
 
+// resolveRoom gets room by Douyin ID, URL or provider:id and remembers the
+// Douyin ID of Douyin rooms, so that it can be fetched with other rooms next
+// time.
+func resolveRoom(ctx context.Context, id string) (*dylive.Room, error) {
+	provider, input, err := dylive.ParseProviderID(id)
+	if err != nil {
+		return nil, err
+	}
+	if provider != dylive.Douyin {
+		return provider.Resolve(ctx, input)
+	}
+	room, err := dylive.ResolveRoom(ctx, input)
+	if err == nil && room.DouyinId != "" {
+		resolved[id] = room.DouyinId
+	}
+	return room, err
+}
+
 func updateStreamUrl(room *dylive.Room) {
+	quality := preferQuality
+	if preferCodec != "" {
+		if info, ok := room.Streams[quality]; !ok || info.Codec != preferCodec {
+			if best := room.BestQuality(preferCodec); best != "" {
+				quality = best
+			}
+		}
+	}
 	if preferFormat == "hls" || preferFormat == "m3u8" {
-		room.StreamUrl = room.HlsUrlForQuality(preferQuality)
+		room.StreamUrl = room.HlsUrlForQuality(quality)
 	} else {
-		room.StreamUrl = room.FlvUrlForQuality(preferQuality)
+		room.StreamUrl = room.FlvUrlForQuality(quality)
 	}
 }
 
-func runCommand(tpl string, room *dylive.Room) error {
+func readTemplate(tpl string) string {
 	if len(tpl) > 1 && strings.HasPrefix(tpl, "@") {
 		content, _ := os.ReadFile(tpl[1:])
 		tpl = string(content)
 	}
+	return tpl
+}
+
+// shellCommand creates command that runs the template output with sh -c.
+func shellCommand(tpl string, room *dylive.Room) (*exec.Cmd, error) {
+	tpl = readTemplate(tpl)
 	if tpl == "" {
-		return nil
+		return nil, nil
 	}
-	tmpl, err := template.New("").Parse(tpl)
+	cmdStr, err := dylive.NewTemplateData(*room).Execute(tpl)
 	if err != nil {
-		return err
-	}
-	var cmdStrBuilder strings.Builder
-	err = tmpl.Execute(&cmdStrBuilder, struct {
-		*dylive.Room
-		Timestamp int64
-	}{
-		Room:      room,
-		Timestamp: time.Now().Unix(),
-	})
-	if err != nil {
-		return err
+		return nil, err
 	}
-	cmdStr := cmdStrBuilder.String()
 	if cmdStr == "" {
-		return nil
+		return nil, nil
+	}
+	return exec.Command("sh", "-c", cmdStr), nil
+}
+
+// argsCommand creates command from JSON array of templates, each element
+// becomes exactly one argument and no shell is involved.
+func argsCommand(tpl string, room *dylive.Room) (*exec.Cmd, error) {
+	tpl = readTemplate(tpl)
+	if tpl == "" {
+		return nil, nil
+	}
+	var tpls []string
+	if err := json.Unmarshal([]byte(tpl), &tpls); err != nil {
+		return nil, fmt.Errorf("-exec must be JSON array of strings: %w", err)
+	}
+	data := dylive.NewTemplateData(*room)
+	var args []string
+	for _, t := range tpls {
+		arg, err := data.Execute(t)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 0 || args[0] == "" {
+		return nil, nil
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+func runCommand(room *dylive.Room) error {
+	var cmd *exec.Cmd
+	var err error
+	if execTemplate != "" {
+		cmd, err = argsCommand(execTemplate, room)
+	} else {
+		cmd, err = shellCommand(commadnTemplate, room)
+	}
+	if err != nil || cmd == nil {
+		return err
 	}
-	cmd := exec.Command("sh", "-c", cmdStr)
+	cmd.Env = append(os.Environ(), room.Env()...)
 	err = cmd.Start()
 	if err == nil {
-		log.Println("Command", cmdStr, "started as PID", cmd.Process.Pid)
+		log.Println("Command", cmd.String(), "started as PID", cmd.Process.Pid)
 		pids[room.Id] = cmd.Process.Pid
 		go func() {
 			err := cmd.Wait()
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/caiguanhao/dylive"
+)
+
+func Test_argsCommand(t *testing.T) {
+	room := &dylive.Room{
+		Id:        "1",
+		StreamUrl: "http://example.com/stream.flv",
+		User:      dylive.User{Name: "a b/c"},
+	}
+	cases := []struct {
+		tpl  string
+		args []string
+		err  bool
+	}{
+		{`["ffmpeg", "-i", "{{.StreamUrl}}", "{{safe .User.Name}} {{.Id}}.flv"]`, []string{"ffmpeg", "-i", "http://example.com/stream.flv", "a b_c 1.flv"}, false},
+		{`["echo", "{{.User.Name}}; rm -rf /"]`, []string{"echo", "a b/c; rm -rf /"}, false},
+		{`["{{if false}}x{{end}}", "a"]`, nil, false},
+		{`[]`, nil, false},
+		{``, nil, false},
+		{`ffmpeg -i {{.StreamUrl}}`, nil, true},
+		{`["{{.Unknown}}"]`, nil, true},
+	}
+	for _, c := range cases {
+		cmd, err := argsCommand(c.tpl, room)
+		if (err != nil) != c.err {
+			t.Errorf("argsCommand(%q) error: %v", c.tpl, err)
+			continue
+		}
+		var args []string
+		if cmd != nil {
+			args = cmd.Args
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("argsCommand(%q) should have args %q instead of %q", c.tpl, c.args, args)
+		}
+	}
+}
+
+func Test_shellCommand(t *testing.T) {
+	room := &dylive.Room{Id: "1", User: dylive.User{Name: "O'Neil"}}
+	cmd, err := shellCommand(`echo {{shellquote .User.Name}} {{.Id}}`, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"sh", "-c", `echo 'O'\''Neil' 1`}; !reflect.DeepEqual(cmd.Args, expected) {
+		t.Errorf("wrong args %q", cmd.Args)
+	}
+	if cmd, _ := shellCommand("", room); cmd != nil {
+		t.Error("should not create command for empty template")
+	}
+}
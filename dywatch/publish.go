@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/caiguanhao/dylive"
+)
+
+var (
+	publishMu  sync.Mutex
+	publishing = map[string]bool{}
+)
+
+// startPublishing pushes the stream of the room to the RTMP URL of
+// rtmpTemplate in the background, unless it is already being pushed.
+func startPublishing(room *dylive.Room) error {
+	rtmpUrl, err := dylive.NewTemplateData(*room).Execute(readTemplate(rtmpTemplate))
+	if err != nil || rtmpUrl == "" {
+		return err
+	}
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	if publishing[room.Id] {
+		return nil
+	}
+	publishing[room.Id] = true
+	getRoom := dylive.GetRoom
+	if provider, ok := dylive.LookupProvider(room.Provider); ok {
+		getRoom = provider.Room
+	}
+	src := &dylive.StreamSource{
+		DouyinId: room.DouyinId,
+		Quality:  preferQuality,
+		GetRoom:  getRoom,
+	}
+	p := &dylive.Publisher{
+		Url: rtmpUrl,
+		OnError: func(err error) {
+			log.Printf("Pushing %s (%s) failed, reconnecting: %s", room.User.Name, room.DouyinId, err)
+		},
+	}
+	log.Printf("Pushing %s (%s) to %s", room.User.Name, room.DouyinId, rtmpUrl)
+	go func() {
+		defer func() {
+			publishMu.Lock()
+			delete(publishing, room.Id)
+			publishMu.Unlock()
+		}()
+		ctx := context.Background()
+		r, err := src.Open(ctx)
+		if err == nil {
+			err = p.Publish(ctx, r)
+			r.Close()
+		}
+		if err != nil {
+			log.Printf("Pushing %s (%s) stopped: %s", room.User.Name, room.DouyinId, err)
+		} else {
+			log.Printf("Pushing %s (%s) finished", room.User.Name, room.DouyinId)
+		}
+	}()
+	return nil
+}
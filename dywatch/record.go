@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/caiguanhao/dylive"
+)
+
+var (
+	recordMu  sync.Mutex
+	recording = map[string]bool{}
+	recordWg  sync.WaitGroup
+
+	recordCtx, stopRecording = context.WithCancel(context.Background())
+)
+
+// startRecording saves the stream of the room to the file of
+// recordTemplate in the background, unless it is already being saved. Only
+// audio is saved if the file name ends with .aac or .m4a.
+func startRecording(room *dylive.Room) error {
+	name, err := dylive.NewTemplateData(*room).Execute(readTemplate(recordTemplate))
+	if err != nil || name == "" {
+		return err
+	}
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if recording[room.Id] || recordCtx.Err() != nil {
+		return nil
+	}
+	if dir := filepath.Dir(name); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	file, err := dylive.CreateFile(name)
+	if err != nil {
+		return err
+	}
+	recording[room.Id] = true
+	getRoom := dylive.GetRoom
+	if provider, ok := dylive.LookupProvider(room.Provider); ok {
+		getRoom = provider.Room
+	}
+	src := &dylive.StreamSource{
+		DouyinId: room.DouyinId,
+		Quality:  preferQuality,
+		GetRoom:  getRoom,
+	}
+	rec := &dylive.Recorder{Format: dylive.RecordFormatOf(name)}
+	log.Printf("Recording %s (%s) to %s", room.User.Name, room.DouyinId, file.Name())
+	recordWg.Add(1)
+	go func() {
+		defer recordWg.Done()
+		defer func() {
+			recordMu.Lock()
+			delete(recording, room.Id)
+			recordMu.Unlock()
+		}()
+		ctx := recordCtx
+		r, err := src.Open(ctx)
+		if err == nil {
+			err = rec.Record(ctx, r, file)
+			r.Close()
+		}
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			log.Printf("Recording %s (%s) stopped: %s", room.User.Name, room.DouyinId, err)
+		} else {
+			log.Printf("Recording %s (%s) finished", room.User.Name, room.DouyinId)
+		}
+	}()
+	return nil
+}
+
+// finishRecordingsOnSignal stops all recordings on SIGINT or SIGTERM and
+// exits after their files are completed, for example M4A has its moov box
+// written at the end. Another signal exits immediately.
+func finishRecordingsOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+	signal.Stop(c)
+	log.Println("Stopping recordings")
+	recordMu.Lock()
+	stopRecording()
+	recordMu.Unlock()
+	recordWg.Wait()
+	os.Exit(0)
+}
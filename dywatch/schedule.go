@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// window is a time range of some days of week, end can be earlier than
+	// start if the range crosses midnight.
+	window struct {
+		days       [7]bool
+		start, end int // minutes since midnight
+	}
+
+	schedule struct {
+		location *time.Location
+		windows  []window
+	}
+
+	scheduleConfig struct {
+		Timezone string   `json:"timezone"`
+		Windows  []string `json:"windows"`
+	}
+
+	// history stores the times streamers started their live streams.
+	history struct {
+		file   string
+		Starts map[string][]int64 `json:"starts"`
+	}
+)
+
+const (
+	maxHistory       = 50
+	learnBefore      = 30 * time.Minute
+	learnAfter       = 60 * time.Minute
+	minutesOfDay     = 24 * 60
+	scheduleExamples = `"mon-fri 19:00-23:00", "sat,sun 10:00-02:00" or "20:00-22:00"`
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseWindow parses window like "mon-fri 19:00-23:00", days can be
+// omitted to mean every day.
+func parseWindow(str string) (w window, err error) {
+	fields := strings.Fields(str)
+	var days, times string
+	switch len(fields) {
+	case 1:
+		days, times = "daily", fields[0]
+	case 2:
+		days, times = fields[0], fields[1]
+	default:
+		err = fmt.Errorf("bad window %q, examples: %s", str, scheduleExamples)
+		return
+	}
+	if w.days, err = parseDays(days); err != nil {
+		return
+	}
+	parts := strings.Split(times, "-")
+	if len(parts) != 2 {
+		err = fmt.Errorf("bad time range %q", times)
+		return
+	}
+	if w.start, err = parseClock(parts[0]); err != nil {
+		return
+	}
+	if w.end, err = parseClock(parts[1]); err != nil {
+		return
+	}
+	return
+}
+
+func parseDays(str string) (days [7]bool, err error) {
+	if str == "daily" || str == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return
+	}
+	for _, part := range strings.Split(str, ",") {
+		ab := strings.Split(part, "-")
+		var a, b int
+		if a, err = parseWeekday(ab[0]); err != nil {
+			return
+		}
+		b = a
+		if len(ab) == 2 {
+			if b, err = parseWeekday(ab[1]); err != nil {
+				return
+			}
+		} else if len(ab) > 2 {
+			err = fmt.Errorf("bad days %q", part)
+			return
+		}
+		for i := a; ; i = (i + 1) % 7 {
+			days[i] = true
+			if i == b {
+				break
+			}
+		}
+	}
+	return
+}
+
+func parseWeekday(str string) (int, error) {
+	str = strings.ToLower(str)
+	for i, day := range weekdays {
+		if strings.HasPrefix(str, day) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("bad day of week %q", str)
+}
+
+func parseClock(str string) (int, error) {
+	hm := strings.Split(str, ":")
+	if len(hm) != 2 {
+		return 0, fmt.Errorf("bad time %q", str)
+	}
+	h, err1 := strconv.Atoi(hm[0])
+	m, err2 := strconv.Atoi(hm[1])
+	if err1 != nil || err2 != nil || h < 0 || h > 24 || m < 0 || m > 59 || h*60+m > minutesOfDay {
+		return 0, fmt.Errorf("bad time %q", str)
+	}
+	return h*60 + m, nil
+}
+
+func (w window) contains(t time.Time) bool {
+	day := int(t.Weekday())
+	m := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return w.days[day] && m >= w.start && m < w.end
+	}
+	return (w.days[day] && m >= w.start) || (w.days[(day+6)%7] && m < w.end)
+}
+
+func (s schedule) contains(t time.Time) bool {
+	t = t.In(s.location)
+	for _, w := range s.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSchedules reads schedule file which maps Douyin ID to timezone and
+// windows.
+func loadSchedules(file string) (map[string]schedule, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var configs map[string]scheduleConfig
+	if err := json.Unmarshal(content, &configs); err != nil {
+		return nil, err
+	}
+	schedules := map[string]schedule{}
+	for id, config := range configs {
+		s := schedule{location: time.Local}
+		if config.Timezone != "" {
+			if s.location, err = time.LoadLocation(config.Timezone); err != nil {
+				return nil, err
+			}
+		}
+		for _, str := range config.Windows {
+			w, err := parseWindow(str)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", id, err)
+			}
+			s.windows = append(s.windows, w)
+		}
+		schedules[id] = s
+	}
+	return schedules, nil
+}
+
+func loadHistory(file string) *history {
+	h := &history{file: file}
+	content, _ := os.ReadFile(file)
+	json.Unmarshal(content, h)
+	if h.Starts == nil {
+		h.Starts = map[string][]int64{}
+	}
+	return h
+}
+
+// add records a live stream start and saves history to file.
+func (h *history) add(id string, t time.Time) {
+	starts := append(h.Starts[id], t.Unix())
+	if len(starts) > maxHistory {
+		starts = starts[len(starts)-maxHistory:]
+	}
+	h.Starts[id] = starts
+	content, _ := json.Marshal(h)
+	os.WriteFile(h.file, content, 0644)
+}
+
+// expects reports whether t is near the time of day the streamer has gone
+// live before. ok is false if there is no history of the streamer.
+func (h *history) expects(id string, t time.Time) (expected, ok bool) {
+	starts := h.Starts[id]
+	if len(starts) == 0 {
+		return false, false
+	}
+	m := t.Hour()*60 + t.Minute()
+	before, after := int(learnBefore/time.Minute), int(learnAfter/time.Minute)
+	for _, start := range starts {
+		s := time.Unix(start, 0).In(t.Location())
+		diff := (m - (s.Hour()*60 + s.Minute()) + minutesOfDay) % minutesOfDay
+		if diff <= after || minutesOfDay-diff <= before {
+			return true, true
+		}
+	}
+	return false, true
+}
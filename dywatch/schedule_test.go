@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseWindow(t *testing.T) {
+	bad := []string{"", "19:00", "mon-fri", "mon 19-23", "abc 19:00-23:00", "25:00-26:00", "mon 1 2"}
+	for _, str := range bad {
+		if _, err := parseWindow(str); err == nil {
+			t.Errorf("parseWindow(%q) should fail", str)
+		}
+	}
+	w, err := parseWindow("fri-mon 22:30-02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.days != [7]bool{true, true, false, false, false, true, true} {
+		t.Errorf("wrong days: %v", w.days)
+	}
+	if w.start != 22*60+30 || w.end != 2*60 {
+		t.Errorf("wrong range: %d-%d", w.start, w.end)
+	}
+}
+
+func Test_windowContains(t *testing.T) {
+	w, _ := parseWindow("mon,wed 22:00-02:00")
+	cases := []struct {
+		time     string
+		contains bool
+	}{
+		{"2022-01-03 21:59", false}, // monday
+		{"2022-01-03 22:00", true},
+		{"2022-01-04 01:59", true}, // tuesday
+		{"2022-01-04 02:00", false},
+		{"2022-01-04 22:30", false},
+		{"2022-01-05 23:00", true}, // wednesday
+	}
+	for _, c := range cases {
+		tm, _ := time.Parse("2006-01-02 15:04", c.time)
+		if actual := w.contains(tm); actual != c.contains {
+			t.Errorf("contains(%s) should be %t instead of %t", c.time, c.contains, actual)
+		}
+	}
+	s := schedule{location: time.FixedZone("UTC+8", 8*3600), windows: []window{w}}
+	tm, _ := time.Parse("2006-01-02 15:04", "2022-01-03 14:30") // 22:30 in UTC+8
+	if !s.contains(tm) {
+		t.Error("schedule should contain time in its timezone")
+	}
+}
+
+func Test_historyExpects(t *testing.T) {
+	h := &history{Starts: map[string][]int64{}}
+	if _, ok := h.expects("a", time.Now()); ok {
+		t.Error("should not expect anything without history")
+	}
+	start, _ := time.Parse("2006-01-02 15:04", "2022-01-03 23:50")
+	h.Starts["a"] = []int64{start.Unix()}
+	cases := []struct {
+		time     string
+		expected bool
+	}{
+		{"2022-01-10 23:19", false},
+		{"2022-01-10 23:20", true},
+		{"2022-01-11 00:50", true},
+		{"2022-01-11 00:51", false},
+	}
+	for _, c := range cases {
+		tm, _ := time.Parse("2006-01-02 15:04", c.time)
+		if actual, _ := h.expects("a", tm); actual != c.expected {
+			t.Errorf("expects(%s) should be %t instead of %t", c.time, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package dylive
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Strategies to extract JSON data from Douyin pages, in the order they are
+// tried.
+const (
+	StrategyPaceF      = "pace_f"      // self.__pace_f.push([...]) script chunks
+	StrategyRenderData = "render_data" // URL-encoded JSON in <script id="RENDER_DATA">
+	StrategyGlobals    = "globals"     // window.__INIT_PROPS__ = {...} and alike
+)
+
+var (
+	strategies = []struct {
+		name    string
+		extract func(html string) []interface{}
+	}{
+		{StrategyPaceF, extractPaceF},
+		{StrategyRenderData, extractRenderData},
+		{StrategyGlobals, extractGlobals},
+	}
+
+	renderDataRegexp = regexp.MustCompile(`(?s)<script[^>]+id="RENDER_DATA"[^>]*>(.*?)</script>`)
+	globalsRegexp    = regexp.MustCompile(`window\.__[A-Za-z_]+__\s*=\s*`)
+)
+
+// OnExtract, if set, is called each time data is found in a Douyin page by
+// GetRoom, GetUser, GetCategories and others, with URL of the page, path of
+// the data and name of the strategy that found it, for example to log when
+// Douyin changes its page layout and another strategy is used instead.
+var OnExtract func(url, path, strategy string)
+
+// pageData holds JSON documents found in a page by each strategy. Documents
+// are only extracted when a strategy is needed.
+type pageData struct {
+	url     string
+	html    string
+	docs    map[string][]interface{}
+	blocked error // returned by find instead of DataNotFoundError
+}
+
+func newPageData(html string) *pageData {
+	return &pageData{html: html, docs: map[string][]interface{}{}}
+}
+
+// ExtractData finds the JSON value at path in a Douyin page and decodes it
+// into target. Path is a dot-separated list of object keys, such as
+// "roomStore.roomInfo", and may start at any depth of the JSON documents in
+// the page. It returns the name of the strategy that found the value.
+func ExtractData(html, path string, target interface{}) (strategy string, err error) {
+	return newPageData(html).find(path, target)
+}
+
+func (p *pageData) find(path string, target interface{}) (string, error) {
+	keys := strings.Split(path, ".")
+	for _, s := range strategies {
+		docs, ok := p.docs[s.name]
+		if !ok {
+			docs = s.extract(p.html)
+			p.docs[s.name] = docs
+		}
+		for _, doc := range docs {
+			value, ok := findPath(doc, keys)
+			if !ok {
+				continue
+			}
+			b, err := json.Marshal(value)
+			if err != nil {
+				return s.name, err
+			}
+			if OnExtract != nil {
+				OnExtract(p.url, path, s.name)
+			}
+			return s.name, json.Unmarshal(b, target)
+		}
+	}
+	if p.blocked != nil {
+		return "", p.blocked
+	}
+	return "", &DataNotFoundError{Path: path}
+}
+
+// DataNotFoundError is returned when no strategy finds the data in a page,
+// usually because Douyin has changed its page layout.
+type DataNotFoundError struct {
+	Path string
+}
+
+func (e *DataNotFoundError) Error() string {
+	names := make([]string, 0, len(strategies))
+	for _, s := range strategies {
+		names = append(names, s.name)
+	}
+	return fmt.Sprintf("%s not found in page (tried %s)", e.Path, strings.Join(names, ", "))
+}
+
+// findPath searches value depth-first for the first object from which keys
+// can be followed, and returns the value at the end of keys.
+func findPath(value interface{}, keys []string) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if found, ok := followPath(v, keys); ok {
+			return found, true
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if found, ok := findPath(v[name], keys); ok {
+				return found, true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if found, ok := findPath(child, keys); ok {
+				return found, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func followPath(obj map[string]interface{}, keys []string) (interface{}, bool) {
+	var value interface{} = obj
+	for _, key := range keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok || value == nil {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func decodeJSON(input string) (interface{}, bool) {
+	dec := json.NewDecoder(strings.NewReader(input))
+	dec.UseNumber()
+	var v interface{}
+	if dec.Decode(&v) != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+func extractPaceF(html string) (docs []interface{}) {
+	for _, part := range getDataInHtml(html) {
+		if v, ok := decodeJSON(part); ok {
+			docs = append(docs, v)
+		}
+	}
+	return
+}
+
+func extractRenderData(html string) (docs []interface{}) {
+	for _, match := range renderDataRegexp.FindAllStringSubmatch(html, -1) {
+		data, err := url.PathUnescape(strings.TrimSpace(match[1]))
+		if err != nil {
+			continue
+		}
+		if v, ok := decodeJSON(data); ok {
+			docs = append(docs, v)
+		}
+	}
+	return
+}
+
+func extractGlobals(html string) (docs []interface{}) {
+	for _, loc := range globalsRegexp.FindAllStringIndex(html, -1) {
+		if v, ok := decodeJSON(html[loc[1]:]); ok {
+			docs = append(docs, v)
+		}
+	}
+	return
+}
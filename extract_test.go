@@ -0,0 +1,116 @@
+package dylive
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractData(t *testing.T) {
+	const room = `{"state":{"roomStore":{"roomInfo":{"web_rid":"123","room":{"id_str":"7000000000000000001","status":2}}}}}`
+	paceF := `<script>self.__pace_f.push([1,"a:[\"$\",\"$L1\",null,` + jsonEscape(room) + `]\n"])</script>`
+	renderData := `<script id="RENDER_DATA" type="application/json">` + url.PathEscape(`{"app":{"initialState":`+room+`}}`) + `</script>`
+	globals := `<script>window.__INIT_PROPS__ = ` + room + `;window.other = 1</script>`
+	cases := []struct {
+		html     string
+		strategy string
+	}{
+		{"<html>" + paceF + "</html>", StrategyPaceF},
+		{"<html>" + renderData + "</html>", StrategyRenderData},
+		{"<html>" + globals + "</html>", StrategyGlobals},
+		{"<html>" + globals + renderData + "</html>", StrategyRenderData},
+	}
+	for _, c := range cases {
+		var info dyliveRoomInfo
+		strategy, err := ExtractData(c.html, "roomStore.roomInfo", &info)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if strategy != c.strategy {
+			t.Errorf("strategy should be %s instead of %s", c.strategy, strategy)
+		}
+		if info.WebRid != "123" || info.Room.IdStr != "7000000000000000001" || info.Room.Status != 2 {
+			t.Errorf("%s: wrong room info: %+v", strategy, info)
+		}
+	}
+	var info dyliveRoomInfo
+	if _, err := ExtractData("<html>"+globals+"</html>", "roomStore.roomInfo.anchor", &info); err == nil {
+		t.Error("should return error if path does not exist")
+	} else if _, ok := err.(*DataNotFoundError); !ok {
+		t.Errorf("error should be DataNotFoundError instead of %T", err)
+	}
+}
+
+func jsonEscape(s string) string {
+	out := ""
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			out += `\`
+		}
+		out += string(r)
+	}
+	return out
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestOnExtract(t *testing.T) {
+	defer func(s *Session) { DefaultSession = s }(DefaultSession)
+	defer func(c *http.Client) { HTTPClient = c }(HTTPClient)
+	defer func(f func(string, string, string)) { OnExtract = f }(OnExtract)
+	DefaultSession = &Session{}
+	HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `<script>window.__INIT_PROPS__ = {"roomStore":{"roomInfo":{"web_rid":"abc","room":{"id_str":"1","status":2}}}}</script>`
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})}
+	var extracted []string
+	OnExtract = func(url, path, strategy string) {
+		extracted = append(extracted, url, path, strategy)
+	}
+	if _, err := GetRoom(context.Background(), "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"https://live.douyin.com/abc", "roomStore.roomInfo", StrategyGlobals}; !reflect.DeepEqual(extracted, expected) {
+		t.Errorf("OnExtract should be called with %q instead of %q", expected, extracted)
+	}
+}
+
+func TestRoomDataNotFound(t *testing.T) {
+	defer func(s *Session) { DefaultSession = s }(DefaultSession)
+	defer func(c *http.Client) { HTTPClient = c }(HTTPClient)
+	DefaultSession = &Session{}
+	const noRoom = `<script>window.__INIT_PROPS__ = {"roomStore":{"roomInfo":{"web_rid":"abc","room":{}}}}</script>`
+	for body, status := range map[string]RoomStatus{
+		"<html>new layout</html>": RoomStatusUnknown, // DataNotFoundError
+		noRoom:                    RoomStatusNotFound,
+		noRoom + "<div>该直播间已被封禁</div>": RoomStatusBanned,
+	} {
+		pages := 0
+		HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/abc" {
+				pages++
+			}
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}, nil
+		})}
+		_, err := GetRoom(context.Background(), "abc")
+		var dataErr *DataNotFoundError
+		var statusErr *RoomStatusError
+		if status == RoomStatusUnknown && !errors.As(err, &dataErr) ||
+			status != RoomStatusUnknown && (!errors.As(err, &statusErr) || statusErr.Status != status || statusErr.DouyinId != "abc") {
+			t.Errorf("wrong error for %s: %v", body, err)
+		}
+		if pages != 1 {
+			t.Errorf("missing room should not reset session and retry, requested page %d times", pages)
+		}
+	}
+}
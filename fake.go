@@ -0,0 +1,106 @@
+package dylive
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// FakeProvider is an in-memory provider for tests. Its rooms and categories
+// can be changed while it is being used.
+type FakeProvider struct {
+	ProviderName string // defaults to fake
+
+	mu    sync.Mutex
+	tree  CategoryTree
+	rooms []Room
+	err   error
+}
+
+// Name returns the name of the provider.
+func (f *FakeProvider) Name() string {
+	if f.ProviderName != "" {
+		return f.ProviderName
+	}
+	return "fake"
+}
+
+// SetCategories sets categories of the provider.
+func (f *FakeProvider) SetCategories(tree CategoryTree) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tree = tree
+}
+
+// SetRoom adds the room, or replaces the room with the same DouyinId.
+func (f *FakeProvider) SetRoom(room Room) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	room.Provider = f.Name()
+	for i := range f.rooms {
+		if f.rooms[i].DouyinId == room.DouyinId {
+			f.rooms[i] = room
+			return
+		}
+	}
+	f.rooms = append(f.rooms, room)
+}
+
+// SetError makes all methods return err until it is set to nil.
+func (f *FakeProvider) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Categories returns categories set by SetCategories.
+func (f *FakeProvider) Categories(ctx context.Context) (CategoryTree, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.tree, nil
+}
+
+// RoomsByCategory returns rooms on air whose category has the id.
+func (f *FakeProvider) RoomsByCategory(ctx context.Context, categoryId string) ([]Room, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	var rooms []Room
+	for _, room := range f.rooms {
+		if room.Category != nil && room.Category.Id == categoryId && room.IsOnAir() {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms, nil
+}
+
+// Room returns the room with the DouyinId.
+func (f *FakeProvider) Room(ctx context.Context, id string) (*Room, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, room := range f.rooms {
+		if room.DouyinId == id {
+			return &room, nil
+		}
+	}
+	return nil, fmt.Errorf("%s room %s does not exist", f.Name(), id)
+}
+
+// Resolve returns the room with the DouyinId, which is the last path
+// segment if input is a URL.
+func (f *FakeProvider) Resolve(ctx context.Context, input string) (*Room, error) {
+	if strings.Contains(input, "/") {
+		input = path.Base(strings.TrimRight(input, "/"))
+	}
+	return f.Room(ctx, input)
+}
@@ -0,0 +1,185 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// ECMAArray is encoded as AMF0 ECMA array instead of object.
+type ECMAArray map[string]interface{}
+
+// EncodeAMF encodes values of float64, int, int64, string, bool, nil,
+// []interface{}, []float64, map[string]interface{} or ECMAArray as AMF0.
+// Properties are sorted by key.
+func EncodeAMF(values ...interface{}) []byte {
+	var b []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case float64:
+			b = append(b, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.BigEndian.PutUint64(b[len(b)-8:], math.Float64bits(v))
+		case int:
+			b = append(b, EncodeAMF(float64(v))...)
+		case int64:
+			b = append(b, EncodeAMF(float64(v))...)
+		case bool:
+			if v {
+				b = append(b, 1, 1)
+			} else {
+				b = append(b, 1, 0)
+			}
+		case string:
+			if len(v) > 0xffff {
+				b = append(b, 12, byte(len(v)>>24), byte(len(v)>>16), byte(len(v)>>8), byte(len(v)))
+			} else {
+				b = append(b, 2, byte(len(v)>>8), byte(len(v)))
+			}
+			b = append(b, v...)
+		case []interface{}:
+			b = append(b, 10, byte(len(v)>>24), byte(len(v)>>16), byte(len(v)>>8), byte(len(v)))
+			b = append(b, EncodeAMF(v...)...)
+		case []float64:
+			b = append(b, 10, byte(len(v)>>24), byte(len(v)>>16), byte(len(v)>>8), byte(len(v)))
+			for _, f := range v {
+				b = append(b, EncodeAMF(f)...)
+			}
+		case map[string]interface{}:
+			b = append(b, 3)
+			b = append(b, encodeProperties(v)...)
+		case ECMAArray:
+			b = append(b, 8, byte(len(v)>>24), byte(len(v)>>16), byte(len(v)>>8), byte(len(v)))
+			b = append(b, encodeProperties(v)...)
+		default:
+			b = append(b, 5)
+		}
+	}
+	return b
+}
+
+func encodeProperties(obj map[string]interface{}) (b []byte) {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b = append(b, byte(len(key)>>8), byte(len(key)))
+		b = append(b, key...)
+		b = append(b, EncodeAMF(obj[key])...)
+	}
+	return append(b, 0, 0, 9)
+}
+
+// DecodeAMF decodes AMF0 values in data, until the end of data or an
+// unsupported value.
+func DecodeAMF(data []byte) (values []interface{}) {
+	d := &amfDecoder{data: data}
+	for len(d.data) > 0 && d.err == nil {
+		values = append(values, d.value())
+	}
+	return
+}
+
+// Metadata returns the properties of onMetaData script tag data.
+func Metadata(data []byte) (map[string]interface{}, bool) {
+	values := DecodeAMF(data)
+	if len(values) < 2 || values[0] != "onMetaData" {
+		return nil, false
+	}
+	switch meta := values[1].(type) {
+	case ECMAArray:
+		return meta, true
+	case map[string]interface{}:
+		return meta, true
+	}
+	return nil, false
+}
+
+// amfDecoder decodes AMF0 values. Unsupported values stop decoding.
+type amfDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *amfDecoder) read(n int) []byte {
+	if d.err != nil || len(d.data) < n {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *amfDecoder) str() string {
+	b := d.read(2)
+	if b == nil {
+		return ""
+	}
+	return string(d.read(int(binary.BigEndian.Uint16(b))))
+}
+
+func (d *amfDecoder) object() map[string]interface{} {
+	obj := map[string]interface{}{}
+	for d.err == nil {
+		key := d.str()
+		if key == "" {
+			d.read(1) // object end marker
+			break
+		}
+		obj[key] = d.value()
+	}
+	return obj
+}
+
+func (d *amfDecoder) value() interface{} {
+	marker := d.read(1)
+	if marker == nil {
+		return nil
+	}
+	switch marker[0] {
+	case 0: // number
+		if b := d.read(8); b != nil {
+			return math.Float64frombits(binary.BigEndian.Uint64(b))
+		}
+	case 1: // boolean
+		if b := d.read(1); b != nil {
+			return b[0] != 0
+		}
+	case 2: // string
+		return d.str()
+	case 12: // long string
+		b := d.read(4)
+		if b == nil {
+			return nil
+		}
+		return string(d.read(int(binary.BigEndian.Uint32(b))))
+	case 3: // object
+		return d.object()
+	case 8: // ECMA array
+		d.read(4)
+		return ECMAArray(d.object())
+	case 5, 6: // null, undefined
+		return nil
+	case 10: // strict array
+		b := d.read(4)
+		if b == nil {
+			return nil
+		}
+		var arr []interface{}
+		for i := uint32(0); i < binary.BigEndian.Uint32(b) && d.err == nil; i++ {
+			arr = append(arr, d.value())
+		}
+		return arr
+	case 11: // date
+		if b := d.read(10); b != nil {
+			return math.Float64frombits(binary.BigEndian.Uint64(b[:8]))
+		}
+	default:
+		d.err = fmt.Errorf("unsupported AMF0 marker %d", marker[0])
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package flv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAMF(t *testing.T) {
+	long := strings.Repeat("x", 0x10000)
+	values := DecodeAMF(EncodeAMF("onStatus", 1, nil, true, map[string]interface{}{
+		"code":  "NetStream.Publish.Start",
+		"times": []float64{0, 2},
+	}, ECMAArray{"long": long}))
+	expected := []interface{}{"onStatus", float64(1), nil, true, map[string]interface{}{
+		"code":  "NetStream.Publish.Start",
+		"times": []interface{}{float64(0), float64(2)},
+	}, ECMAArray{"long": long}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("wrong values %v", values)
+	}
+	if values := DecodeAMF([]byte{2, 0, 1, 'a', 0xff}); len(values) != 2 || values[0] != "a" {
+		t.Errorf("should stop at unsupported value: %v", values)
+	}
+}
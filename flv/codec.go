@@ -0,0 +1,366 @@
+package flv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// VideoCodec returns codec of video tag data (h264, h265 or av1), either of
+// legacy codec ID or FourCC of enhanced FLV.
+func VideoCodec(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if data[0]&0x80 != 0 && len(data) >= 5 {
+		switch string(data[1:5]) {
+		case "avc1":
+			return "h264"
+		case "hvc1":
+			return "h265"
+		case "av01":
+			return "av1"
+		}
+		return ""
+	}
+	switch data[0] & 0xf {
+	case 7:
+		return "h264"
+	case 12:
+		return "h265"
+	}
+	return ""
+}
+
+// AudioCodec returns codec of audio tag data (aac or mp3).
+func AudioCodec(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	switch data[0] >> 4 {
+	case 10:
+		return "aac"
+	case 2, 14:
+		return "mp3"
+	}
+	return ""
+}
+
+// Types of video packets.
+const (
+	PacketSequenceHeader = 0
+	PacketNALU           = 1
+)
+
+// ParseVideo splits video tag data of H.264 or H.265, including enhanced
+// FLV, into codec, packet type, composition time offset in milliseconds and
+// payload. Codec is empty for other codecs and end of sequence.
+func ParseVideo(data []byte) (codec string, packetType byte, cts int32, payload []byte) {
+	if len(data) < 5 {
+		return
+	}
+	if data[0]&0x80 != 0 {
+		if codec = VideoCodec(data); codec != "h264" && codec != "h265" {
+			return "", 0, 0, nil
+		}
+		switch data[0] & 0xf {
+		case 0: // sequence start
+			return codec, PacketSequenceHeader, 0, data[5:]
+		case 1: // coded frames
+			if len(data) < 8 {
+				return "", 0, 0, nil
+			}
+			return codec, PacketNALU, int32(uint32(data[5])<<24|uint32(data[6])<<16|uint32(data[7])<<8) >> 8, data[8:]
+		case 3: // coded frames without composition time
+			return codec, PacketNALU, 0, data[5:]
+		}
+		return "", 0, 0, nil
+	}
+	if codec = VideoCodec(data); codec != "h264" && codec != "h265" {
+		return "", 0, 0, nil
+	}
+	if data[1] > PacketNALU { // end of sequence
+		return "", 0, 0, nil
+	}
+	return codec, data[1], int32(uint32(data[2])<<24|uint32(data[3])<<16|uint32(data[4])<<8) >> 8, data[5:]
+}
+
+// DecoderConfig is AVCDecoderConfigurationRecord or
+// HEVCDecoderConfigurationRecord.
+type DecoderConfig struct {
+	Codec     string   // h264 or h265
+	NALLength int      // size of NAL unit length
+	ParamSets [][]byte // VPS, SPS and PPS NAL units
+	Width     int      // from SPS of H.264 only
+	Height    int
+}
+
+// ParseDecoderConfig parses the payload of video sequence header.
+func ParseDecoderConfig(codec string, config []byte) (*DecoderConfig, error) {
+	c := &DecoderConfig{Codec: codec}
+	if codec == "h264" {
+		if len(config) < 6 {
+			return nil, errors.New("invalid AVC decoder configuration")
+		}
+		c.NALLength = int(config[4]&3) + 1
+		p := config[5:]
+		for i, mask := range []byte{0x1f, 0xff} { // SPS, then PPS
+			if len(p) < 1 {
+				break
+			}
+			n := int(p[0] & mask)
+			p = p[1:]
+			for j := 0; j < n; j++ {
+				if len(p) < 2 || len(p) < 2+int(binary.BigEndian.Uint16(p)) {
+					return nil, errors.New("invalid AVC decoder configuration")
+				}
+				size := int(binary.BigEndian.Uint16(p))
+				if i == 0 && j == 0 {
+					c.Width, c.Height = parseAVCSPS(p[2 : 2+size])
+				}
+				c.ParamSets = append(c.ParamSets, p[2:2+size])
+				p = p[2+size:]
+			}
+		}
+		return c, nil
+	}
+	if codec != "h265" {
+		return nil, errors.New("unsupported codec " + codec)
+	}
+	if len(config) < 23 {
+		return nil, errors.New("invalid HEVC decoder configuration")
+	}
+	c.NALLength = int(config[21]&3) + 1
+	arrays, p := int(config[22]), config[23:]
+	for i := 0; i < arrays; i++ {
+		if len(p) < 3 {
+			return nil, errors.New("invalid HEVC decoder configuration")
+		}
+		n := int(binary.BigEndian.Uint16(p[1:]))
+		p = p[3:]
+		for j := 0; j < n; j++ {
+			if len(p) < 2 || len(p) < 2+int(binary.BigEndian.Uint16(p)) {
+				return nil, errors.New("invalid HEVC decoder configuration")
+			}
+			size := int(binary.BigEndian.Uint16(p))
+			c.ParamSets = append(c.ParamSets, p[2:2+size])
+			p = p[2+size:]
+		}
+	}
+	return c, nil
+}
+
+// AnnexB converts length-prefixed NAL units of the video payload to Annex B
+// byte stream starting with access unit delimiter, adding parameter sets
+// before keyframes.
+func (c *DecoderConfig) AnnexB(payload []byte, keyframe bool) []byte {
+	startCode := []byte{0, 0, 0, 1}
+	b := append([]byte{}, startCode...)
+	if c.Codec == "h265" {
+		b = append(b, 0x46, 0x01, 0x50)
+	} else {
+		b = append(b, 0x09, 0xf0)
+	}
+	if keyframe {
+		for _, set := range c.ParamSets {
+			b = append(b, startCode...)
+			b = append(b, set...)
+		}
+	}
+	for len(payload) >= c.NALLength {
+		size := 0
+		for _, x := range payload[:c.NALLength] {
+			size = size<<8 | int(x)
+		}
+		payload = payload[c.NALLength:]
+		if size > len(payload) {
+			size = len(payload)
+		}
+		b = append(b, startCode...)
+		b = append(b, payload[:size]...)
+		payload = payload[size:]
+	}
+	return b
+}
+
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// AACConfig is AudioSpecificConfig of AAC.
+type AACConfig struct {
+	ObjectType      byte // 2 for AAC-LC
+	SampleRateIndex byte
+	SampleRate      int
+	Channels        byte
+	Raw             []byte
+}
+
+// ParseAACConfig parses the payload of AAC sequence header. HE-AAC (SBR
+// and PS) is returned as AAC-LC of its core sample rate, because its frames
+// are AAC-LC that decoders extend implicitly, and ADTS cannot signal it.
+// Other object types than Main, LC, SSR and LTP are not supported.
+func ParseAACConfig(data []byte) (*AACConfig, error) {
+	if len(data) < 2 {
+		return nil, errors.New("invalid AAC audio specific config")
+	}
+	c := &AACConfig{
+		ObjectType:      data[0] >> 3,
+		SampleRateIndex: (data[0]&7)<<1 | data[1]>>7,
+		Channels:        (data[1] >> 3) & 0xf,
+		Raw:             append([]byte{}, data...),
+	}
+	if int(c.SampleRateIndex) >= len(aacSampleRates) {
+		return nil, errors.New("unsupported AAC sample rate")
+	}
+	c.SampleRate = aacSampleRates[c.SampleRateIndex]
+	if c.ObjectType == 5 || c.ObjectType == 29 {
+		c.ObjectType = 2
+		c.Raw = []byte{c.ObjectType<<3 | c.SampleRateIndex>>1, c.SampleRateIndex<<7 | c.Channels<<3}
+	}
+	if c.ObjectType < 1 || c.ObjectType > 4 {
+		return nil, fmt.Errorf("unsupported AAC object type %d", c.ObjectType)
+	}
+	return c, nil
+}
+
+// ADTS prefixes raw AAC frame with ADTS header.
+func (c *AACConfig) ADTS(frame []byte) []byte {
+	size := 7 + len(frame)
+	header := []byte{
+		0xff, 0xf1,
+		(c.ObjectType-1)<<6 | c.SampleRateIndex<<2 | c.Channels>>2,
+		(c.Channels&3)<<6 | byte(size>>11),
+		byte(size >> 3),
+		byte(size&7)<<5 | 0x1f,
+		0xfc,
+	}
+	return append(header, frame...)
+}
+
+// parseAVCSPS returns resolution in H.264 sequence parameter set.
+func parseAVCSPS(nal []byte) (width, height int) {
+	if len(nal) < 4 {
+		return
+	}
+	// remove emulation prevention bytes
+	rbsp := make([]byte, 0, len(nal))
+	for i := 0; i < len(nal); i++ {
+		if i >= 2 && nal[i] == 3 && nal[i-1] == 0 && nal[i-2] == 0 {
+			continue
+		}
+		rbsp = append(rbsp, nal[i])
+	}
+	br := &bitReader{data: rbsp[1:]} // skip NAL header
+	profile := br.bits(8)
+	br.bits(16) // constraint flags and level
+	br.ue()     // seq_parameter_set_id
+	chromaFormat := 1
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat = br.ue()
+		if chromaFormat == 3 {
+			br.bits(1) // separate_colour_plane_flag
+		}
+		br.ue()              // bit_depth_luma_minus8
+		br.ue()              // bit_depth_chroma_minus8
+		br.bits(1)           // qpprime_y_zero_transform_bypass_flag
+		if br.bits(1) == 1 { // seq_scaling_matrix_present_flag
+			count := 8
+			if chromaFormat == 3 {
+				count = 12
+			}
+			for i := 0; i < count; i++ {
+				if br.bits(1) == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					last, next := 8, 8
+					for j := 0; j < size; j++ {
+						if next != 0 {
+							next = (last + br.se() + 256) % 256
+						}
+						if next != 0 {
+							last = next
+						}
+					}
+				}
+			}
+		}
+	}
+	br.ue()          // log2_max_frame_num_minus4
+	switch br.ue() { // pic_order_cnt_type
+	case 0:
+		br.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		br.bits(1) // delta_pic_order_always_zero_flag
+		br.se()    // offset_for_non_ref_pic
+		br.se()    // offset_for_top_to_bottom_field
+		for n := br.ue(); n > 0 && br.err == nil; n-- {
+			br.se()
+		}
+	}
+	br.ue()    // max_num_ref_frames
+	br.bits(1) // gaps_in_frame_num_value_allowed_flag
+	widthInMbs := br.ue() + 1
+	heightInMapUnits := br.ue() + 1
+	frameMbsOnly := br.bits(1)
+	if frameMbsOnly == 0 {
+		br.bits(1) // mb_adaptive_frame_field_flag
+	}
+	br.bits(1) // direct_8x8_inference_flag
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if br.bits(1) == 1 {
+		cropLeft, cropRight, cropTop, cropBottom = br.ue(), br.ue(), br.ue(), br.ue()
+	}
+	if br.err != nil {
+		return 0, 0
+	}
+	cropX, cropY := 1, 2-frameMbsOnly
+	if chromaFormat == 1 || chromaFormat == 2 {
+		cropX = 2
+	}
+	if chromaFormat == 1 {
+		cropY *= 2
+	}
+	width = widthInMbs*16 - (cropLeft+cropRight)*cropX
+	height = (2-frameMbsOnly)*heightInMapUnits*16 - (cropTop+cropBottom)*cropY
+	return
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (br *bitReader) bits(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		if br.pos >= len(br.data)*8 {
+			br.err = io.ErrUnexpectedEOF
+			return 0
+		}
+		v = v<<1 | int(br.data[br.pos/8]>>(7-br.pos%8)&1)
+		br.pos++
+	}
+	return v
+}
+
+// ue reads unsigned Exp-Golomb code.
+func (br *bitReader) ue() int {
+	zeros := 0
+	for br.bits(1) == 0 && br.err == nil && zeros < 32 {
+		zeros++
+	}
+	return 1<<zeros - 1 + br.bits(zeros)
+}
+
+// se reads signed Exp-Golomb code.
+func (br *bitReader) se() int {
+	v := br.ue()
+	if v%2 == 1 {
+		return (v + 1) / 2
+	}
+	return -v / 2
+}
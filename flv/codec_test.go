@@ -0,0 +1,104 @@
+package flv
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	testSps720  = []byte{0x67, 0x42, 0x0, 0x1f, 0xf4, 0x2, 0x80, 0x2d, 0xc8}
+	testSps1080 = []byte{0x67, 0x42, 0x0, 0x1f, 0xf4, 0x3, 0xc0, 0x11, 0x3f, 0x2a}
+)
+
+func TestParseAVCSPS(t *testing.T) {
+	if w, h := parseAVCSPS(testSps720); w != 1280 || h != 720 {
+		t.Errorf("should be 1280x720 instead of %dx%d", w, h)
+	}
+	if w, h := parseAVCSPS(testSps1080); w != 1920 || h != 1080 {
+		t.Errorf("should be 1920x1080 instead of %dx%d", w, h)
+	}
+}
+
+func TestParseDecoderConfig(t *testing.T) {
+	pps := []byte{0x68, 0xce, 0x38, 0x80}
+	avc := []byte{1, 0x42, 0, 0x1f, 0xff, 0xe1, 0, byte(len(testSps1080))}
+	avc = append(avc, testSps1080...)
+	avc = append(avc, 1, 0, byte(len(pps)))
+	avc = append(avc, pps...)
+	config, err := ParseDecoderConfig("h264", avc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.NALLength != 4 || len(config.ParamSets) != 2 || config.Width != 1920 || config.Height != 1080 {
+		t.Errorf("wrong AVC config %+v", config)
+	}
+	annexB := config.AnnexB([]byte{0, 0, 0, 2, 0x65, 0x88, 0, 0, 0, 1, 0x06}, true)
+	expected := []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 0, 1}
+	expected = append(expected, testSps1080...)
+	expected = append(expected, 0, 0, 0, 1)
+	expected = append(expected, pps...)
+	expected = append(expected, 0, 0, 0, 1, 0x65, 0x88, 0, 0, 0, 1, 0x06)
+	if !bytes.Equal(annexB, expected) {
+		t.Errorf("wrong Annex B % x", annexB)
+	}
+
+	hevc := make([]byte, 23)
+	hevc[21], hevc[22] = 0xf3, 3
+	for _, nal := range [][]byte{{0x40, 1}, {0x42, 1}, {0x44, 1}} {
+		hevc = append(hevc, nal[0]>>1, 0, 1, 0, byte(len(nal)))
+		hevc = append(hevc, nal...)
+	}
+	config, err = ParseDecoderConfig("h265", hevc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.NALLength != 4 || len(config.ParamSets) != 3 || config.ParamSets[2][0] != 0x44 {
+		t.Errorf("wrong HEVC config %+v", config)
+	}
+	if _, err := ParseDecoderConfig("h265", hevc[:30]); err == nil {
+		t.Error("should return error for truncated config")
+	}
+}
+
+func TestParseVideo(t *testing.T) {
+	codec, typ, cts, payload := ParseVideo([]byte{0x27, 1, 0xff, 0xff, 0xd8, 9})
+	if codec != "h264" || typ != PacketNALU || cts != -40 || !bytes.Equal(payload, []byte{9}) {
+		t.Errorf("wrong legacy video %s %d %d", codec, typ, cts)
+	}
+	codec, typ, cts, _ = ParseVideo([]byte{0x91, 'h', 'v', 'c', '1', 0, 0, 40, 9})
+	if codec != "h265" || typ != PacketNALU || cts != 40 {
+		t.Errorf("wrong enhanced video %s %d %d", codec, typ, cts)
+	}
+	if codec, _, _, _ := ParseVideo([]byte{0x12, 0, 0, 0, 0}); codec != "" {
+		t.Error("should not parse Sorenson H.263")
+	}
+}
+
+func TestAACConfig(t *testing.T) {
+	config, err := ParseAACConfig([]byte{0x12, 0x10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ObjectType != 2 || config.SampleRate != 44100 || config.Channels != 2 {
+		t.Errorf("wrong config %+v", config)
+	}
+	adts := config.ADTS([]byte{1, 2, 3})
+	if !bytes.Equal(adts, []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x5f, 0xfc, 1, 2, 3}) {
+		t.Errorf("wrong ADTS % x", adts)
+	}
+
+	// HE-AAC of 44.1kHz with explicit SBR signalling
+	config, err = ParseAACConfig([]byte{0x2b, 0x92, 0x08, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ObjectType != 2 || config.SampleRate != 22050 || config.Channels != 2 || !bytes.Equal(config.Raw, []byte{0x13, 0x90}) {
+		t.Errorf("HE-AAC should be AAC-LC of core sample rate: %+v", config)
+	}
+	if adts := config.ADTS(nil); adts[2]>>6 != 1 {
+		t.Errorf("ADTS of HE-AAC should have LC profile: % x", adts)
+	}
+	if _, err := ParseAACConfig([]byte{0xf8, 0x00}); err == nil {
+		t.Error("should return error for unsupported object type")
+	}
+}
@@ -0,0 +1,187 @@
+// Package flv reads and writes FLV streams and files of H.264 or H.265
+// video and AAC audio.
+package flv
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Types of tags.
+const (
+	TagAudio  = 8
+	TagVideo  = 9
+	TagScript = 18
+)
+
+// HeaderSize is the size of FLV header with the first previous tag size.
+const HeaderSize = 13
+
+// Header returns FLV header with the first previous tag size.
+func Header(hasAudio, hasVideo bool) []byte {
+	h := []byte{'F', 'L', 'V', 1, 0, 0, 0, 0, 9, 0, 0, 0, 0}
+	h[4] = flags(hasAudio, hasVideo)
+	return h
+}
+
+func flags(hasAudio, hasVideo bool) (f byte) {
+	if hasAudio {
+		f |= 4
+	}
+	if hasVideo {
+		f |= 1
+	}
+	return
+}
+
+// Tag is an FLV tag.
+type Tag struct {
+	Type      byte
+	Timestamp uint32 // milliseconds
+	Data      []byte
+}
+
+// Bytes returns the tag with its previous tag size.
+func (t Tag) Bytes() []byte {
+	size := len(t.Data)
+	b := make([]byte, 11+size+4)
+	b[0] = t.Type
+	b[1], b[2], b[3] = byte(size>>16), byte(size>>8), byte(size)
+	b[4], b[5], b[6], b[7] = byte(t.Timestamp>>16), byte(t.Timestamp>>8), byte(t.Timestamp), byte(t.Timestamp>>24)
+	copy(b[11:], t.Data)
+	binary.BigEndian.PutUint32(b[11+size:], uint32(11+size))
+	return b
+}
+
+// IsKeyframe reports whether the tag is a video keyframe.
+func (t Tag) IsKeyframe() bool {
+	return t.Type == TagVideo && len(t.Data) > 0 && (t.Data[0]>>4)&7 == 1
+}
+
+// IsSequenceHeader reports whether the tag is AVC or HEVC decoder
+// configuration, or AAC audio specific config.
+func (t Tag) IsSequenceHeader() bool {
+	if len(t.Data) < 2 {
+		return false
+	}
+	switch t.Type {
+	case TagVideo:
+		if t.Data[0]&0x80 != 0 { // enhanced FLV
+			return t.Data[0]&0xf == 0
+		}
+		codec := t.Data[0] & 0xf
+		return (codec == 7 || codec == 12) && t.Data[1] == 0
+	case TagAudio:
+		return t.Data[0]>>4 == 10 && t.Data[1] == 0
+	}
+	return false
+}
+
+// IsMedia reports whether the tag is audio or video.
+func (t Tag) IsMedia() bool {
+	return t.Type == TagAudio || t.Type == TagVideo
+}
+
+// Reader reads FLV tags. A new FLV header between tags, as sent after
+// reconnecting to a live stream, is skipped and counted in Resets.
+type Reader struct {
+	r      io.Reader
+	flags  byte
+	header bool
+	tags   int
+	resets int
+}
+
+// NewReader returns a reader of the FLV stream.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Next reads the next tag.
+func (fr *Reader) Next() (Tag, error) {
+	head := make([]byte, 11)
+	for {
+		if _, err := io.ReadFull(fr.r, head); err != nil {
+			return Tag{}, err
+		}
+		if string(head[:3]) != "FLV" {
+			break
+		}
+		// the rest of FLV header and the first previous tag size
+		if _, err := io.ReadFull(fr.r, make([]byte, 2)); err != nil {
+			return Tag{}, err
+		}
+		fr.flags = head[4]
+		fr.header = true
+		if skip := int64(binary.BigEndian.Uint32(head[5:9])) - 9; skip > 0 {
+			if _, err := io.CopyN(io.Discard, fr.r, skip); err != nil {
+				return Tag{}, err
+			}
+		}
+		if fr.tags > 0 {
+			fr.resets++
+		}
+	}
+	if !fr.header {
+		return Tag{}, errors.New("not an FLV stream")
+	}
+	size := int(head[1])<<16 | int(head[2])<<8 | int(head[3])
+	tag := Tag{
+		Type:      head[0] & 0x1f,
+		Timestamp: uint32(head[4])<<16 | uint32(head[5])<<8 | uint32(head[6]) | uint32(head[7])<<24,
+		Data:      make([]byte, size+4), // with previous tag size
+	}
+	if _, err := io.ReadFull(fr.r, tag.Data); err != nil {
+		return Tag{}, err
+	}
+	tag.Data = tag.Data[:size]
+	fr.tags++
+	return tag, nil
+}
+
+// HasAudio reports whether the last header has audio flag.
+func (fr *Reader) HasAudio() bool { return fr.flags&4 != 0 }
+
+// HasVideo reports whether the last header has video flag.
+func (fr *Reader) HasVideo() bool { return fr.flags&1 != 0 }
+
+// Tags returns the number of tags read.
+func (fr *Reader) Tags() int { return fr.tags }
+
+// Resets returns the number of headers after the first one.
+func (fr *Reader) Resets() int { return fr.resets }
+
+// Timeline keeps timestamps of media tags increasing when the stream starts
+// again from 0 after reconnecting. Sequence headers and metadata get the
+// timestamp of the last media tag.
+type Timeline struct {
+	offset int64
+	last   uint32
+	resets int
+	rebase bool
+}
+
+// Fix rewrites timestamp of the tag, resets is the number of headers seen
+// so far, as returned by Reader.Resets.
+func (tl *Timeline) Fix(tag *Tag, resets int) {
+	if resets != tl.resets {
+		tl.resets = resets
+		tl.rebase = true
+	}
+	if !tag.IsMedia() || tag.IsSequenceHeader() {
+		tag.Timestamp = tl.last
+		return
+	}
+	if tl.rebase {
+		tl.offset = int64(tl.last) + 1 - int64(tag.Timestamp)
+		tl.rebase = false
+	}
+	tag.Timestamp = uint32(int64(tag.Timestamp) + tl.offset)
+	tl.last = tag.Timestamp
+}
+
+// Last returns the timestamp of the last media tag.
+func (tl *Timeline) Last() uint32 {
+	return tl.last
+}
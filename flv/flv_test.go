@@ -0,0 +1,73 @@
+package flv
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		buf.Write(Header(true, false))
+		buf.Write(Tag{Type: TagAudio, Timestamp: 0, Data: []byte{0xaf, 0, 0x12, 0x10}}.Bytes())
+		buf.Write(Tag{Type: TagAudio, Timestamp: 0x1000020, Data: []byte{0xaf, 1, 0x21}}.Bytes())
+	}
+	fr := NewReader(&buf)
+	var tags []Tag
+	for {
+		tag, err := fr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) != 4 || fr.Tags() != 4 || fr.Resets() != 1 || !fr.HasAudio() || fr.HasVideo() {
+		t.Fatalf("wrong tags %d, resets %d", len(tags), fr.Resets())
+	}
+	if !tags[0].IsSequenceHeader() || tags[1].IsSequenceHeader() || tags[1].Timestamp != 0x1000020 || !bytes.Equal(tags[1].Data, []byte{0xaf, 1, 0x21}) {
+		t.Errorf("wrong tag %+v", tags[1])
+	}
+	if _, err := NewReader(bytes.NewReader(make([]byte, 20))).Next(); err == nil {
+		t.Error("should return error if it is not FLV")
+	}
+}
+
+func TestTag(t *testing.T) {
+	keyframe := Tag{Type: TagVideo, Data: []byte{0x17, 1, 0, 0, 0}}
+	if !keyframe.IsKeyframe() || keyframe.IsSequenceHeader() {
+		t.Error("should be keyframe")
+	}
+	if (Tag{Type: TagVideo, Data: []byte{0x27, 1, 0, 0, 0}}).IsKeyframe() {
+		t.Error("should not be keyframe")
+	}
+	if !(Tag{Type: TagVideo, Data: []byte{0x1c, 0, 0, 0, 0}}).IsSequenceHeader() {
+		t.Error("should be HEVC sequence header")
+	}
+	if !(Tag{Type: TagVideo, Data: []byte{0x90, 'h', 'v', 'c', '1'}}).IsSequenceHeader() {
+		t.Error("should be enhanced HEVC sequence header")
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	var tl Timeline
+	expected := []uint32{1000, 1040, 1040, 1041, 1081}
+	for i, c := range []struct {
+		resets int
+		tag    Tag
+	}{
+		{0, Tag{Type: TagVideo, Timestamp: 1000, Data: []byte{0x17, 1}}},
+		{0, Tag{Type: TagVideo, Timestamp: 1040, Data: []byte{0x27, 1}}},
+		{1, Tag{Type: TagVideo, Timestamp: 0, Data: []byte{0x17, 0}}}, // sequence header after reconnecting
+		{1, Tag{Type: TagVideo, Timestamp: 0, Data: []byte{0x17, 1}}},
+		{1, Tag{Type: TagVideo, Timestamp: 40, Data: []byte{0x27, 1}}},
+	} {
+		tag := c.tag
+		tl.Fix(&tag, c.resets)
+		if tag.Timestamp != expected[i] {
+			t.Errorf("timestamp %d should be %d instead of %d", i, expected[i], tag.Timestamp)
+		}
+	}
+}
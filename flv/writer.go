@@ -0,0 +1,230 @@
+package flv
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// DefaultReserve is the default size of space reserved for onMetaData.
+const DefaultReserve = 64 * 1024
+
+// Writer writes FLV tags to a file, with timestamps rewritten to start from
+// 0. If the underlying writer is an io.WriteSeeker, such as *os.File, space
+// is reserved after the header for onMetaData, which Close fills in with
+// duration, file size and keyframe index so that the file is seekable.
+type Writer struct {
+	Reserve int // size of space reserved for onMetaData, defaults to DefaultReserve
+
+	w         io.Writer
+	started   bool
+	pos       int64
+	metaPos   int64 // position of reserved onMetaData, or -1
+	meta      map[string]interface{}
+	hasAudio  bool
+	hasVideo  bool
+	base      uint32
+	baseSet   bool
+	last      uint32
+	keyframes []keyframe
+}
+
+type keyframe struct {
+	time float64 // seconds
+	pos  int64
+}
+
+// metadata properties computed by Writer
+var computedMeta = map[string]bool{
+	"duration": true, "filesize": true, "keyframes": true, "hasKeyframes": true,
+	"hasAudio": true, "hasVideo": true, "lasttimestamp": true, "padding": true,
+}
+
+// NewWriter returns a writer that writes FLV to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, metaPos: -1, meta: map[string]interface{}{}}
+}
+
+// Duration returns duration of media written.
+func (w *Writer) Duration() float64 {
+	return float64(w.last) / 1000
+}
+
+// Size returns number of bytes written.
+func (w *Writer) Size() int64 {
+	return w.pos
+}
+
+// WriteTag writes the tag. Properties of onMetaData are kept and written on
+// Close if the file is seekable.
+func (w *Writer) WriteTag(tag Tag) error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	if tag.Type == TagScript {
+		meta, ok := Metadata(tag.Data)
+		if !ok {
+			return w.write(tag)
+		}
+		for key, value := range meta {
+			if !computedMeta[key] {
+				w.meta[key] = value
+			}
+		}
+		if w.metaPos >= 0 {
+			return nil
+		}
+		return w.write(tag)
+	}
+	if !tag.IsMedia() {
+		return nil
+	}
+	w.hasAudio = w.hasAudio || tag.Type == TagAudio
+	w.hasVideo = w.hasVideo || tag.Type == TagVideo
+	if tag.IsSequenceHeader() {
+		tag.Timestamp = w.last
+	} else {
+		if !w.baseSet {
+			w.base, w.baseSet = tag.Timestamp, true
+		}
+		if tag.Timestamp < w.base {
+			tag.Timestamp = 0
+		} else {
+			tag.Timestamp -= w.base
+		}
+		if tag.Timestamp > w.last {
+			w.last = tag.Timestamp
+		}
+		if tag.IsKeyframe() {
+			w.keyframes = append(w.keyframes, keyframe{float64(tag.Timestamp) / 1000, w.pos})
+		}
+	}
+	return w.write(tag)
+}
+
+func (w *Writer) start() error {
+	w.started = true
+	if _, err := w.w.Write(Header(true, true)); err != nil {
+		return err
+	}
+	w.pos = HeaderSize
+	if ws, ok := w.w.(io.WriteSeeker); !ok {
+		return nil
+	} else if offset, err := ws.Seek(0, io.SeekCurrent); err != nil || offset != HeaderSize {
+		return nil // pipe, or not at the start of file
+	}
+	if w.Reserve <= 0 {
+		w.Reserve = DefaultReserve
+	}
+	data, err := w.metadata(false)
+	if err != nil {
+		return err
+	}
+	w.metaPos = w.pos
+	return w.write(Tag{Type: TagScript, Data: data})
+}
+
+func (w *Writer) write(tag Tag) error {
+	n, err := w.w.Write(tag.Bytes())
+	w.pos += int64(n)
+	return err
+}
+
+// metadata returns onMetaData padded to the reserved size.
+func (w *Writer) metadata(final bool) ([]byte, error) {
+	meta := ECMAArray{}
+	for key, value := range w.meta {
+		meta[key] = value
+	}
+	if final {
+		meta["duration"] = w.Duration()
+		meta["lasttimestamp"] = w.Duration()
+		meta["filesize"] = float64(w.pos)
+		meta["hasAudio"] = w.hasAudio
+		meta["hasVideo"] = w.hasVideo
+		meta["hasKeyframes"] = len(w.keyframes) > 0
+	}
+	keyframes := w.keyframes
+	for {
+		if final && len(keyframes) > 0 {
+			times := make([]float64, len(keyframes))
+			positions := make([]float64, len(keyframes))
+			for i, k := range keyframes {
+				times[i], positions[i] = k.time, float64(k.pos)
+			}
+			meta["keyframes"] = map[string]interface{}{"times": times, "filepositions": positions}
+		}
+		data := EncodeAMF("onMetaData", meta)
+		if padded, ok := pad(data, w.Reserve); ok {
+			return padded, nil
+		}
+		if len(keyframes) == 0 {
+			return nil, errors.New("reserved space is too small for onMetaData")
+		}
+		// keep every other keyframe until it fits
+		thinned := keyframes[:0:0]
+		for i := 0; i < len(keyframes); i += 2 {
+			thinned = append(thinned, keyframes[i])
+		}
+		if len(thinned) == len(keyframes) {
+			thinned = nil
+			delete(meta, "keyframes")
+		}
+		keyframes = thinned
+	}
+}
+
+// pad adds padding property to the ECMA array of onMetaData data, so that
+// the data has exactly size bytes.
+func pad(data []byte, size int) ([]byte, bool) {
+	const name = "padding"
+	n := size - len(data) - (2 + len(name) + 1 + 2)
+	var value []byte
+	switch {
+	case n < 0:
+		return nil, false
+	case n <= 0xffff:
+		value = []byte{2, byte(n >> 8), byte(n)}
+	default:
+		n -= 2
+		value = []byte{12, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	prop := append([]byte{0, byte(len(name))}, name...)
+	prop = append(prop, value...)
+	prop = append(prop, make([]byte, n)...)
+	end := len(data) - 3 // object end marker
+	padded := append(append(append([]byte{}, data[:end]...), prop...), data[end:]...)
+	// onMetaData string takes 13 bytes, then marker and count of ECMA array
+	count := binary.BigEndian.Uint32(padded[14:])
+	binary.BigEndian.PutUint32(padded[14:], count+1)
+	return padded, true
+}
+
+// Close writes onMetaData with duration, file size and keyframe index, if
+// the file is seekable. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.metaPos < 0 {
+		return nil
+	}
+	ws := w.w.(io.WriteSeeker)
+	data, err := w.metadata(true)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write([]byte{flags(w.hasAudio, w.hasVideo)}); err != nil {
+		return err
+	}
+	if _, err := ws.Seek(w.metaPos, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(Tag{Type: TagScript, Data: data}.Bytes()); err != nil {
+		return err
+	}
+	_, err = ws.Seek(w.pos, io.SeekStart)
+	return err
+}
@@ -0,0 +1,120 @@
+package flv
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "test.flv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := NewWriter(file)
+	w.Reserve = 1024
+	tags := []Tag{
+		{Type: TagScript, Data: EncodeAMF("onMetaData", ECMAArray{"width": 1280, "duration": 0})},
+		{Type: TagVideo, Timestamp: 5000, Data: []byte{0x17, 0, 0, 0, 0, 1}},
+		{Type: TagAudio, Timestamp: 5000, Data: []byte{0xaf, 0, 0x12, 0x10}},
+	}
+	for ts := uint32(5000); ts < 15000; ts += 40 {
+		frame := []byte{0x27, 1, 0, 0, 0, 1}
+		if ts%2000 == 0 {
+			frame = []byte{0x17, 1, 0, 0, 0, 1}
+		}
+		tags = append(tags, Tag{Type: TagVideo, Timestamp: ts, Data: frame}, Tag{Type: TagAudio, Timestamp: ts, Data: []byte{0xaf, 1, 1}})
+	}
+	for _, tag := range tags {
+		if err := w.WriteTag(tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file.Seek(0, io.SeekStart)
+	data, _ := io.ReadAll(file)
+	if int64(len(data)) != w.Size() {
+		t.Fatalf("file should be %d bytes instead of %d", w.Size(), len(data))
+	}
+	fr := NewReader(bytes.NewReader(data))
+	tag, err := fr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tag.Data) != 1024 {
+		t.Errorf("onMetaData should take reserved space instead of %d bytes", len(tag.Data))
+	}
+	meta, ok := Metadata(tag.Data)
+	if !ok {
+		t.Fatal("first tag should be onMetaData")
+	}
+	if meta["duration"] != 9.96 || meta["filesize"] != float64(len(data)) || meta["width"] != float64(1280) ||
+		meta["hasVideo"] != true || meta["hasAudio"] != true {
+		t.Errorf("wrong metadata %v", meta)
+	}
+	keyframes, _ := meta["keyframes"].(map[string]interface{})
+	times, _ := keyframes["times"].([]interface{})
+	positions, _ := keyframes["filepositions"].([]interface{})
+	if len(times) != 5 || len(positions) != 5 || times[0] != 1.0 {
+		t.Fatalf("wrong keyframes %v", keyframes)
+	}
+	for i, pos := range positions {
+		tag, err := NewReader(io.MultiReader(bytes.NewReader(Header(true, true)), bytes.NewReader(data[int(pos.(float64)):]))).Next()
+		if err != nil || !tag.IsKeyframe() || float64(tag.Timestamp)/1000 != times[i] {
+			t.Errorf("keyframe %d should be at %v", i, pos)
+		}
+	}
+	first, _ := fr.Next()
+	if first.Timestamp != 0 {
+		t.Errorf("timestamps should start from 0 instead of %d", first.Timestamp)
+	}
+}
+
+func TestWriterKeyframeIndexTooLarge(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "test.flv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := NewWriter(file)
+	w.Reserve = 1024
+	for ts := uint32(0); ts < 200000; ts += 1000 {
+		w.WriteTag(Tag{Type: TagVideo, Timestamp: ts, Data: []byte{0x17, 1, 0, 0, 0, 1}})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Seek(0, io.SeekStart)
+	tag, _ := NewReader(file).Next()
+	meta, _ := Metadata(tag.Data)
+	keyframes, _ := meta["keyframes"].(map[string]interface{})
+	if times, _ := keyframes["times"].([]interface{}); len(times) == 0 || len(times) >= 200 {
+		t.Errorf("keyframe index should be thinned to fit, got %d", len(times))
+	}
+	if meta["hasAudio"] != false {
+		t.Error("should have no audio")
+	}
+}
+
+func TestWriterNotSeekable(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteTag(Tag{Type: TagScript, Data: EncodeAMF("onMetaData", ECMAArray{"width": 1280})})
+	w.WriteTag(Tag{Type: TagVideo, Timestamp: 100, Data: []byte{0x17, 1, 0, 0, 0, 1}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fr := NewReader(&buf)
+	if tag, _ := fr.Next(); tag.Type != TagScript {
+		t.Error("onMetaData should be written as is")
+	}
+	if tag, _ := fr.Next(); tag.Timestamp != 0 {
+		t.Error("timestamps should start from 0")
+	}
+}
@@ -0,0 +1,307 @@
+package dylive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+// PIDs of the MPEG-TS streams.
+const (
+	tsPmtPid   = 0x1000
+	tsVideoPid = 0x100
+	tsAudioPid = 0x101
+)
+
+type hlsSegment struct {
+	Seq      int
+	Duration time.Duration
+	Data     []byte
+}
+
+// hlsMuxer converts FLV tags of H.264 or H.265 video and AAC audio to
+// MPEG-TS segments, cut at keyframes. The first segment starts when the
+// sequence headers of the tracks flagged in the FLV header are known, so
+// that its PMT lists all of them. A flagged track that has not come after
+// the target duration of media is given up, and segments are cut by audio
+// if it is the video.
+type hlsMuxer struct {
+	duration time.Duration // target duration of a segment
+	size     int           // number of segments to keep
+	hasVideo bool
+	hasAudio bool
+
+	waiting   bool   // whether a media tag has come before the first segment
+	waitStart uint32 // timestamp of the first media tag
+
+	video *flv.DecoderConfig
+	audio *flv.AACConfig
+
+	cc       map[int]byte
+	cur      *bytes.Buffer
+	curStart uint32
+	seq      int
+	segments []hlsSegment
+}
+
+func newHlsMuxer(duration time.Duration, size int, hasVideo, hasAudio bool) *hlsMuxer {
+	return &hlsMuxer{
+		duration: duration,
+		size:     size,
+		hasVideo: hasVideo,
+		hasAudio: hasAudio,
+		cc:       map[int]byte{},
+	}
+}
+
+// write muxes the tag and returns true if a new segment is completed.
+func (m *hlsMuxer) write(tag flv.Tag) (completed bool) {
+	switch tag.Type {
+	case flv.TagVideo:
+		codec, packetType, cts, payload := flv.ParseVideo(tag.Data)
+		if codec == "" {
+			return
+		}
+		if packetType == flv.PacketSequenceHeader {
+			if config, err := flv.ParseDecoderConfig(codec, payload); err == nil {
+				m.video = config
+			}
+			return
+		}
+		if m.video == nil || codec != m.video.Codec {
+			return
+		}
+		if m.cur == nil && !m.ready(tag.Timestamp) {
+			return
+		}
+		if tag.IsKeyframe() && (m.cur == nil || time.Duration(tag.Timestamp-m.curStart)*time.Millisecond >= m.duration) {
+			completed = m.cut(tag.Timestamp)
+		}
+		if m.cur == nil {
+			return
+		}
+		dts := int64(tag.Timestamp) * 90
+		pts := dts + int64(cts)*90
+		m.writePes(tsVideoPid, 0xe0, pts, dts, m.video.AnnexB(payload, tag.IsKeyframe()), true, tag.IsKeyframe())
+	case flv.TagAudio:
+		if flv.AudioCodec(tag.Data) != "aac" || len(tag.Data) < 2 {
+			return
+		}
+		if tag.IsSequenceHeader() {
+			if config, err := flv.ParseAACConfig(tag.Data[2:]); err == nil {
+				m.audio = config
+			}
+			return
+		}
+		if m.audio == nil {
+			return
+		}
+		if m.cur == nil && !m.ready(tag.Timestamp) {
+			return
+		}
+		if !m.hasVideo && (m.cur == nil || time.Duration(tag.Timestamp-m.curStart)*time.Millisecond >= m.duration) {
+			completed = m.cut(tag.Timestamp)
+		}
+		if m.cur == nil {
+			return
+		}
+		pts := int64(tag.Timestamp) * 90
+		m.writePes(tsAudioPid, 0xc0, pts, pts, m.audio.ADTS(tag.Data[2:]), !m.hasVideo, false)
+	}
+	return
+}
+
+// ready reports whether the first segment can start at ts, giving up the
+// tracks that have not come after the target duration since the first
+// media tag.
+func (m *hlsMuxer) ready(ts uint32) bool {
+	if !m.waiting {
+		m.waiting = true
+		m.waitStart = ts
+	}
+	if time.Duration(ts-m.waitStart)*time.Millisecond >= m.duration {
+		m.hasVideo = m.hasVideo && m.video != nil
+		m.hasAudio = m.hasAudio && m.audio != nil
+	}
+	return (!m.hasVideo || m.video != nil) && (!m.hasAudio || m.audio != nil)
+}
+
+// cut completes current segment and starts a new one.
+func (m *hlsMuxer) cut(ts uint32) (completed bool) {
+	if m.cur != nil {
+		m.segments = append(m.segments, hlsSegment{
+			Seq:      m.seq,
+			Duration: time.Duration(ts-m.curStart) * time.Millisecond,
+			Data:     m.cur.Bytes(),
+		})
+		if len(m.segments) > m.size {
+			m.segments = m.segments[len(m.segments)-m.size:]
+		}
+		m.seq++
+		completed = true
+	}
+	m.cur = &bytes.Buffer{}
+	m.curStart = ts
+	m.writeTables()
+	return
+}
+
+// playlist returns the live playlist, with segment URIs prefixed.
+func (m *hlsMuxer) playlist(prefix string) string {
+	var target float64 = 1
+	for _, s := range m.segments {
+		target = math.Max(target, math.Ceil(s.Duration.Seconds()))
+	}
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(target))
+	if len(m.segments) > 0 {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", m.segments[0].Seq)
+	}
+	for _, s := range m.segments {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s%d.ts\n", s.Duration.Seconds(), prefix, s.Seq)
+	}
+	return b.String()
+}
+
+func (m *hlsMuxer) segment(seq int) *hlsSegment {
+	for i := range m.segments {
+		if m.segments[i].Seq == seq {
+			return &m.segments[i]
+		}
+	}
+	return nil
+}
+
+func (m *hlsMuxer) writeTables() {
+	pat := []byte{0, 0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xe0 | tsPmtPid>>8, tsPmtPid & 0xff}
+	m.writePsi(0, pat)
+
+	pcrPid := tsAudioPid
+	if m.hasVideo {
+		pcrPid = tsVideoPid
+	}
+	var streams []byte
+	if m.hasVideo {
+		typ := byte(0x1b)
+		if m.video != nil && m.video.Codec == "h265" {
+			typ = 0x24
+		}
+		streams = append(streams, typ, 0xe0|tsVideoPid>>8, tsVideoPid&0xff, 0xf0, 0)
+	}
+	if m.audio != nil {
+		streams = append(streams, 0x0f, 0xe0|tsAudioPid>>8, tsAudioPid&0xff, 0xf0, 0)
+	}
+	pmt := []byte{0, 0x02, 0xb0, byte(13 + len(streams)), 0, 1, 0xc1, 0, 0, byte(0xe0 | pcrPid>>8), byte(pcrPid), 0xf0, 0}
+	m.writePsi(tsPmtPid, append(pmt, streams...))
+}
+
+// writePsi writes table of pointer field and section without CRC.
+func (m *hlsMuxer) writePsi(pid int, table []byte) {
+	crc := crc32Mpeg(table[1:])
+	table = append(table, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+	p := make([]byte, 188)
+	for i := range p {
+		p[i] = 0xff
+	}
+	p[0], p[1], p[2], p[3] = 0x47, 0x40|byte(pid>>8), byte(pid), 0x10|m.nextCC(pid)
+	copy(p[4:], table)
+	m.cur.Write(p)
+}
+
+func (m *hlsMuxer) writePes(pid int, streamId byte, pts, dts int64, data []byte, pcr, keyframe bool) {
+	header := []byte{0, 0, 1, streamId, 0, 0, 0x80, 0x80, 5}
+	header = append(header, tsTimestamp(2, pts)...)
+	if dts != pts {
+		header[7], header[8] = 0xc0, 10
+		header[len(header)-5] |= 0x10
+		header = append(header, tsTimestamp(1, dts)...)
+	}
+	if size := len(header) - 6 + len(data); streamId != 0xe0 && size <= 0xffff {
+		binary.BigEndian.PutUint16(header[4:], uint16(size))
+	}
+	pes := append(header, data...)
+	for first := true; len(pes) > 0; first = false {
+		var af []byte
+		hasAf := false
+		if first && (pcr || keyframe) {
+			hasAf = true
+			af = []byte{0}
+			if keyframe {
+				af[0] |= 0x40
+			}
+			if pcr {
+				af[0] |= 0x10
+				base := dts
+				af = append(af, byte(base>>25), byte(base>>17), byte(base>>9), byte(base>>1), byte(base&1)<<7|0x7e, 0)
+			}
+		}
+		avail := 184
+		if hasAf {
+			avail -= 1 + len(af)
+		}
+		if len(pes) < avail {
+			stuffing := avail - len(pes)
+			if !hasAf {
+				hasAf = true
+				stuffing--
+				if stuffing > 0 {
+					af = []byte{0}
+					stuffing--
+				}
+			}
+			af = append(af, bytes.Repeat([]byte{0xff}, stuffing)...)
+			avail = len(pes)
+		}
+		p := make([]byte, 4, 188)
+		p[0], p[1], p[2], p[3] = 0x47, byte(pid>>8), byte(pid), 0x10|m.nextCC(pid)
+		if first {
+			p[1] |= 0x40
+		}
+		if hasAf {
+			p[3] |= 0x20
+			p = append(p, byte(len(af)))
+			p = append(p, af...)
+		}
+		p = append(p, pes[:avail]...)
+		pes = pes[avail:]
+		m.cur.Write(p)
+	}
+}
+
+func (m *hlsMuxer) nextCC(pid int) byte {
+	cc := m.cc[pid]
+	m.cc[pid] = (cc + 1) & 0xf
+	return cc
+}
+
+// tsTimestamp encodes PTS or DTS of 90kHz.
+func tsTimestamp(prefix byte, ts int64) []byte {
+	return []byte{
+		prefix<<4 | byte(ts>>29)&0x0e | 1,
+		byte(ts >> 22),
+		byte(ts>>14)&0xfe | 1,
+		byte(ts >> 7),
+		byte(ts<<1)&0xfe | 1,
+	}
+}
+
+func crc32Mpeg(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -3,20 +3,24 @@ package dylive
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/115.0"
 
 type (
 	Category struct {
-		Id         string
-		Name       string
-		Categories []Category
+		Id         string     `json:"id"`
+		Name       string     `json:"name"`
+		Categories []Category `json:"categories"`
+		Provider   string     `json:"provider,omitempty"` // empty means douyin
 	}
 
 	dyCategory struct {
@@ -34,15 +38,15 @@ type (
 )
 
 // GetCategories gets all Douyin live stream categories.
-func GetCategories(ctx context.Context) ([]Category, error) {
+func GetCategories(ctx context.Context) (CategoryTree, error) {
 	const first = "4_101"
-	var categories []Category
-	data, err := getCategoryPageData(ctx, first, "categoryData")
+	var categories CategoryTree
+	data, err := getCategoryPageData(ctx, first)
 	if err != nil {
 		return nil, err
 	}
 	var cats dyliveCategories
-	if err := getDataInArray(data[0], &cats); err != nil {
+	if _, err := data.find("categoryData", &cats.CategoryData); err != nil {
 		return nil, err
 	}
 	categories = append(categories, deepConvertDyCategories(cats.CategoryData, nil)...)
@@ -77,62 +81,93 @@ func convertDyCategory(c dyCategory, parentIDParts []string, level int, whitelis
 		Id:         fullId,
 		Name:       c.Partition.Title,
 		Categories: children,
+		Provider:   douyinName,
 	}
 }
 
-const (
-	RoomStatusLiveOn RoomStatus = 2 + iota
-	_
-	RoomStatusLiveOff
-)
-
 type (
-	RoomStatus = int
-
 	Room struct {
-		Id                string
-		DouyinId          string
-		StatusCode        RoomStatus
-		Name              string
-		CoverUrl          string
-		WebUrl            string
-		CurrentUsersCount string
-		TotalUsersCount   string
-		Category          *Category
-		User              User
-		StreamUrl         string
-		FlvStreamUrls     map[string]string
-		HlsStreamUrls     map[string]string
+		Id                string                `json:"id"`
+		DouyinId          string                `json:"douyin_id"`
+		StatusCode        RoomStatus            `json:"status"`
+		Name              string                `json:"name"`
+		CoverUrl          string                `json:"cover_url"`
+		WebUrl            string                `json:"web_url"`
+		CurrentUsersCount string                `json:"current_users_count"`
+		TotalUsersCount   string                `json:"total_users_count"`
+		Category          *Category             `json:"category,omitempty"`
+		User              User                  `json:"user"`
+		StreamUrl         string                `json:"stream_url"`
+		FlvStreamUrls     map[string]string     `json:"flv_stream_urls"` // keys are uhd, hd, ld, sd
+		HlsStreamUrls     map[string]string     `json:"hls_stream_urls"` // keys are uhd, hd, ld, sd
+		StartedAt         time.Time             `json:"started_at"`      // zero if unknown
+		Tags              []string              `json:"tags,omitempty"`
+		Orientation       string                `json:"orientation,omitempty"` // landscape or portrait
+		LikeCount         int64                 `json:"like_count"`
+		Streams           map[string]StreamInfo `json:"streams,omitempty"`  // keys are uhd, hd, ld, sd
+		Provider          string                `json:"provider,omitempty"` // empty means douyin
 	}
 
 	User struct {
-		Name    string
-		Picture string
+		Id             string `json:"id"`        // uid
+		SecUid         string `json:"sec_uid"`   // sec_uid, used in www.douyin.com/user/ URLs
+		UniqueId       string `json:"unique_id"` // 抖音号
+		Name           string `json:"name"`
+		Picture        string `json:"picture"`
+		PictureMedium  string `json:"picture_medium"`
+		PictureLarge   string `json:"picture_large"`
+		Signature      string `json:"signature"`
+		FollowerCount  int64  `json:"follower_count"`
+		FollowingCount int64  `json:"following_count"`
+		Verified       bool   `json:"verified"`
+		VerifyReason   string `json:"verify_reason"`
 	}
 
 	dyUser struct {
-		Nickname    string `json:"nickname"`
-		AvatarThumb struct {
-			UrlList []string `json:"url_list"`
-		} `json:"avatar_thumb"`
+		IdStr        string  `json:"id_str"`
+		SecUid       string  `json:"sec_uid"`
+		DisplayId    string  `json:"display_id"`
+		Nickname     string  `json:"nickname"`
+		Signature    string  `json:"signature"`
+		AvatarThumb  dyImage `json:"avatar_thumb"`
+		AvatarMedium dyImage `json:"avatar_medium"`
+		AvatarLarge  dyImage `json:"avatar_large"`
+		FollowInfo   struct {
+			FollowerCount  int64 `json:"follower_count"`
+			FollowingCount int64 `json:"following_count"`
+		} `json:"follow_info"`
+		AuthenticationInfo struct {
+			CustomVerify           string `json:"custom_verify"`
+			EnterpriseVerifyReason string `json:"enterprise_verify_reason"`
+		} `json:"authentication_info"`
+	}
+
+	dyImage struct {
+		UrlList []string `json:"url_list"`
 	}
 
 	dyliveRoom struct {
-		IdStr  string `json:"id_str"`
-		Title  string `json:"title"`
-		Status int    `json:"status"`
-		Cover  struct {
-			UrlList []string `json:"url_list"`
-		} `json:"cover"`
+		IdStr      string  `json:"id_str"`
+		Title      string  `json:"title"`
+		Status     int     `json:"status"`
+		CreateTime int64   `json:"create_time"`
+		LikeCount  int64   `json:"like_count"`
+		Cover      dyImage `json:"cover"`
+		Hashtag    struct {
+			Title string `json:"title"`
+		} `json:"hashtag"`
 		Stats struct {
 			TotalUserStr string `json:"total_user_str"`
 			UserCountStr string `json:"user_count_str"`
+			LikeCount    int64  `json:"like_count"`
 		} `json:"stats"`
 		Owner     dyUser `json:"owner"`
 		StreamUrl struct {
 			FlvPullUrl        map[string]string `json:"flv_pull_url"`
 			HlsPullUrlMap     map[string]string `json:"hls_pull_url_map"`
 			DefaultResolution string            `json:"default_resolution"`
+			StreamOrientation int               `json:"stream_orientation"`
+			LiveCoreSdkData   dyliveSdkData     `json:"live_core_sdk_data"`
 		} `json:"stream_url"`
 		RoomViewStats struct {
 			DisplayValue int `json:"display_value"`
@@ -169,41 +204,64 @@ func (room Room) HlsUrlForQuality(quality string) string {
 func (room Room) urlForQuality(urls map[string]string, quality string) string {
 	quality = strings.ToLower(quality)
 	for key, value := range urls {
-		switch quality {
-		case "uhd":
-			if strings.Contains(key, "FULL_HD") || strings.Contains(value, "_uhd") {
-				return value
-			}
-		case "hd":
-			if strings.Contains(value, "_hd") {
-				return value
-			}
-		case "ld":
-			if strings.Contains(value, "_ld") {
-				return value
-			}
-		case "sd":
-			if strings.Contains(value, "_sd") {
-				return value
-			}
-		default:
-			return room.StreamUrl
+		if key == quality || streamQuality(key, value) == quality {
+			return value
 		}
 	}
 	return room.StreamUrl
 }
 
+// streamQuality returns quality (uhd, hd, ld, sd) of a stream URL from its
+// Douyin key (FULL_HD1, HD1, SD1, SD2) or its file name, or the lower case
+// key if unknown.
+func streamQuality(key, value string) string {
+	switch {
+	case strings.Contains(key, "FULL_HD") || strings.Contains(value, "_uhd"):
+		return "uhd"
+	case strings.Contains(value, "_hd"):
+		return "hd"
+	case strings.Contains(value, "_ld"):
+		return "ld"
+	case strings.Contains(value, "_sd"):
+		return "sd"
+	}
+	return strings.ToLower(key)
+}
+
+// normalizeStreamUrls changes keys of stream URLs from Douyin's names to
+// quality names.
+func normalizeStreamUrls(urls map[string]string) map[string]string {
+	if urls == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(urls))
+	for key := range urls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make(map[string]string, len(urls))
+	for _, key := range keys {
+		quality := streamQuality(key, urls[key])
+		if _, ok := out[quality]; ok {
+			quality = key
+		}
+		out[quality] = urls[key]
+	}
+	return out
+}
+
 // GetRoomsByCategory gets top 15 Douyin live stream rooms of a category.
 func GetRoomsByCategory(ctx context.Context, categoryId string) ([]Room, error) {
-	data, err := getCategoryPageData(ctx, categoryId, "roomsData")
+	data, err := getCategoryPageData(ctx, categoryId)
 	if err != nil {
 		return nil, err
 	}
-	roomsData := data[0]
 	var cat dyliveCategory
-	if err := getDataInArray(roomsData, &cat); err != nil {
+	if _, err := data.find("roomsData", &cat.RoomsData); err != nil {
 		return nil, err
 	}
+	data.find("categoryData", &cat.CategoryData)
+	data.find("categoryList", &cat.CategoryList)
 	var category *Category
 	if categories := deepConvertDyCategories(cat.CategoryData, cat.CategoryList); len(categories) > 0 {
 		category = &categories[0]
@@ -225,81 +283,104 @@ func GetRoomsByCategory(ctx context.Context, categoryId string) ([]Room, error)
 			CoverUrl:          room.Cover,
 			WebUrl:            "https://live.douyin.com/" + room.WebRid,
 			StreamUrl:         room.StreamSrc,
-			FlvStreamUrls:     room.Room.StreamUrl.FlvPullUrl,
-			HlsStreamUrls:     room.Room.StreamUrl.HlsPullUrlMap,
+			FlvStreamUrls:     normalizeStreamUrls(room.Room.StreamUrl.FlvPullUrl),
+			HlsStreamUrls:     normalizeStreamUrls(room.Room.StreamUrl.HlsPullUrlMap),
 			CurrentUsersCount: count,
 			TotalUsersCount:   room.Room.Stats.TotalUserStr,
 			Category:          category,
-			User: User{
-				Name:    room.Room.Owner.Nickname,
-				Picture: room.Avatar,
-			},
+			User:              room.Room.Owner.user(room.Avatar),
+			Provider:          douyinName,
 		})
+		room.Room.enrich(&rooms[len(rooms)-1])
 	}
 	return rooms, nil
 }
 
-func getCategoryPageData(ctx context.Context, id string, filters ...string) ([]string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://live.douyin.com/categorynew/"+id, nil)
+func getCategoryPageData(ctx context.Context, id string) (*pageData, error) {
+	return getPage(ctx, "https://live.douyin.com/categorynew/"+id, nil)
+}
+
+// getPage gets a Douyin page with cookies of session if it is not nil. If
+// ctx is from Cache, the request is made conditional and errNotModified is
+// returned if the page has not changed.
+func getPage(ctx context.Context, url string, session *Session) (*pageData, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", userAgent)
-	resp, err := http.DefaultClient.Do(req)
+	if session != nil {
+		if err := session.prepare(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	v, _ := ctx.Value(validatorsKey{}).(*validators)
+	if v != nil {
+		v.set(req)
+	}
+	resp, err := HTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if session != nil {
+		session.update(resp)
+	}
+	if v != nil {
+		if resp.StatusCode == http.StatusNotModified {
+			return nil, errNotModified
+		}
+		v.update(resp)
+	}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
-	parts := getDataInHtml(string(b))
-	var output []string
-	for _, filter := range filters {
-		var ret string
-		for _, part := range parts {
-			if strings.Contains(part, filter) {
-				ret = part
-				break
-			}
-		}
-		output = append(output, ret)
-	}
-	return output, nil
+	data := newPageData(string(b))
+	data.url = url
+	data.blocked = checkBlocked(resp, data.html)
+	return data, nil
 }
 
 type (
-	dyliveRoomDetails struct {
-		State struct {
-			RoomStore struct {
-				RoomInfo struct {
-					Room   dyliveRoom `json:"room"`
-					WebRid string     `json:"web_rid"`
-					Anchor dyUser     `json:"anchor"`
-				} `json:"roomInfo"`
-			} `json:"roomStore"`
-		} `json:"state"`
+	dyliveRoomInfo struct {
+		Room   dyliveRoom `json:"room"`
+		WebRid string     `json:"web_rid"`
+		Anchor dyUser     `json:"anchor"`
 	}
 )
 
-// GetRoom get live stream room details by Douyin ID (抖音号)
+// GetRoom get live stream room details by Douyin ID (抖音号). If the page
+// is an anti-bot challenge, cookies of DefaultSession are refreshed and it
+// tries again. BlockedError is returned if Douyin serves a
+// verification page, login wall or region block instead, and
+// RoomStatusError if the room does not exist or is banned.
 func GetRoom(ctx context.Context, douyinId string) (*Room, error) {
-	data, err := getLivePageData(ctx, douyinId, "flv_pull_url")
-	if err != nil {
-		return nil, err
-	}
-	if len(data) == 0 || data[0] == "" {
-		return nil, fmt.Errorf("DouyinId %s does not exist", douyinId)
-	}
-	roomsData := data[0]
-	var page dyliveRoomDetails
-	if err := getDataInArray(roomsData, &page); err != nil {
-		return nil, err
+	for attempt := 0; ; attempt++ {
+		data, err := getLivePageData(ctx, douyinId)
+		if err != nil {
+			return nil, err
+		}
+		var info dyliveRoomInfo
+		_, err = data.find("roomStore.roomInfo", &info)
+		if err == nil && info.Room.IdStr != "" {
+			return info.room(), nil
+		}
+		if errors.Is(err, ErrAntiBot) && attempt == 0 && ctx.Err() == nil {
+			// cookies are rejected, try again with new ones
+			DefaultSession.Reset()
+			continue
+		}
+		if errors.Is(err, ErrBlocked) {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("DouyinId %s: %w", douyinId, err)
+		}
+		return nil, missingRoomError(douyinId, data.html)
 	}
+}
 
-	info := page.State.RoomStore.RoomInfo
-
+func (info dyliveRoomInfo) room() *Room {
 	var cover string
 	if len(info.Room.Cover.UrlList) > 0 {
 		cover = info.Room.Cover.UrlList[0]
@@ -314,66 +395,30 @@ func GetRoom(ctx context.Context, douyinId string) (*Room, error) {
 		count = info.Room.Stats.UserCountStr
 	}
 
-	userName := info.Room.Owner.Nickname
-	if userName == "" {
-		userName = info.Anchor.Nickname
-	}
+	user := info.Room.Owner.user("")
+	user.merge(info.Anchor.user(""))
 
-	var userPicture string
-	if len(info.Room.Owner.AvatarThumb.UrlList) > 0 {
-		userPicture = info.Room.Owner.AvatarThumb.UrlList[0]
-	} else if len(info.Anchor.AvatarThumb.UrlList) > 0 {
-		userPicture = info.Anchor.AvatarThumb.UrlList[0]
-	}
-
-	return &Room{
+	room := &Room{
 		Id:                info.Room.IdStr,
 		DouyinId:          info.WebRid,
-		StatusCode:        info.Room.Status,
+		StatusCode:        RoomStatus(info.Room.Status),
 		Name:              info.Room.Title,
 		CoverUrl:          cover,
 		WebUrl:            "https://live.douyin.com/" + info.WebRid,
 		StreamUrl:         streamUrl,
-		FlvStreamUrls:     info.Room.StreamUrl.FlvPullUrl,
-		HlsStreamUrls:     info.Room.StreamUrl.HlsPullUrlMap,
+		FlvStreamUrls:     normalizeStreamUrls(info.Room.StreamUrl.FlvPullUrl),
+		HlsStreamUrls:     normalizeStreamUrls(info.Room.StreamUrl.HlsPullUrlMap),
 		CurrentUsersCount: count,
 		TotalUsersCount:   info.Room.Stats.TotalUserStr,
-		User: User{
-			Name:    userName,
-			Picture: userPicture,
-		},
-	}, nil
+		User:              user,
+		Provider:          douyinName,
+	}
+	info.Room.enrich(room)
+	return room
 }
 
-func getLivePageData(ctx context.Context, douyinId string, filters ...string) ([]string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://live.douyin.com/"+douyinId, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Cookie", "__ac_nonce=064caded4009deafd8b89")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	parts := getDataInHtml(string(b))
-	var output []string
-	for _, filter := range filters {
-		var ret string
-		for _, part := range parts {
-			if strings.Contains(part, filter) {
-				ret = part
-				break
-			}
-		}
-		output = append(output, ret)
-	}
-	return output, nil
+func getLivePageData(ctx context.Context, douyinId string) (*pageData, error) {
+	return getPage(ctx, "https://live.douyin.com/"+douyinId, DefaultSession)
 }
 
 func getDataInHtml(input string) (output []string) {
@@ -419,21 +464,3 @@ func getDataInHtml(input string) (output []string) {
 	}
 	return
 }
-
-func getDataInArray(input string, target interface{}) error {
-	var array []interface{}
-	if err := json.Unmarshal([]byte(input), &array); err != nil {
-		return err
-	}
-	for _, element := range array {
-		switch v := element.(type) {
-		case map[string]interface{}:
-			jsonStr, err := json.Marshal(v)
-			if err != nil {
-				continue
-			}
-			return json.Unmarshal(jsonStr, target)
-		}
-	}
-	return nil
-}
@@ -69,3 +69,30 @@ func TestGetRoom(t *testing.T) {
 	e.SetEscapeHTML(false)
 	e.Encode(room)
 }
+
+func TestGetUser(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := GetUser(ctx, "maidanglaodo")
+	if err != nil {
+		t.Error(err)
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	e.SetEscapeHTML(false)
+	e.Encode(user)
+}
+
+func TestGetRooms(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := GetRooms(ctx, []string{"maidanglaodo", "hongjingmayi", "maidanglaodo"}, nil)
+	if len(results) != 2 {
+		t.Error("should have 2 results")
+	}
+	for id, result := range results {
+		if result.Err != nil {
+			t.Error(id, result.Err)
+		}
+	}
+}
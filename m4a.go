@@ -0,0 +1,145 @@
+package dylive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+// m4aWriter writes raw AAC frames to an M4A file. Frames go to the mdat box
+// as they come, and the moov box with the sample table is appended on
+// close, so the underlying writer must be seekable to fix the mdat size.
+type m4aWriter struct {
+	w      io.WriteSeeker
+	config *flv.AACConfig
+	start  int64 // position of mdat box
+	size   int64 // size of frames written
+	sizes  []uint32
+}
+
+func newM4aWriter(w io.Writer) (*m4aWriter, error) {
+	ws, ok := w.(io.WriteSeeker)
+	if !ok {
+		return nil, errors.New("M4A can only be written to a seekable file")
+	}
+	return &m4aWriter{w: ws}, nil
+}
+
+// writeFrame writes raw AAC frame. The first config is used for the whole
+// file, so a frame of different object type, sample rate or channels is an
+// error, and the frames written before it can still be closed to a playable
+// file.
+func (m *m4aWriter) writeFrame(config *flv.AACConfig, frame []byte) error {
+	if m.config != nil && (config.ObjectType != m.config.ObjectType ||
+		config.SampleRate != m.config.SampleRate || config.Channels != m.config.Channels) {
+		return fmt.Errorf("AAC config changed from %d Hz of %d channels to %d Hz of %d channels",
+			m.config.SampleRate, m.config.Channels, config.SampleRate, config.Channels)
+	}
+	if m.config == nil {
+		m.config = config
+		ftyp := mp4Box("ftyp", []byte("M4A "), u32(0), []byte("M4A isommp42"))
+		if _, err := m.w.Write(ftyp); err != nil {
+			return err
+		}
+		m.start = int64(len(ftyp))
+		// 64-bit size, filled in on close
+		if _, err := m.w.Write(append(append(u32(1), "mdat"...), make([]byte, 8)...)); err != nil {
+			return err
+		}
+	}
+	if _, err := m.w.Write(frame); err != nil {
+		return err
+	}
+	m.size += int64(len(frame))
+	m.sizes = append(m.sizes, uint32(len(frame)))
+	return nil
+}
+
+// close writes moov box and mdat size. It does not close the underlying
+// writer.
+func (m *m4aWriter) close() error {
+	if m.config == nil {
+		return nil
+	}
+	if _, err := m.w.Write(m.moov()); err != nil {
+		return err
+	}
+	end, err := m.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := m.w.Seek(m.start+8, io.SeekStart); err != nil {
+		return err
+	}
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(16+m.size))
+	if _, err := m.w.Write(size); err != nil {
+		return err
+	}
+	_, err = m.w.Seek(end, io.SeekStart)
+	return err
+}
+
+// moov returns movie box of one audio track, with all frames in one chunk
+// and each frame of 1024 samples.
+func (m *m4aWriter) moov() []byte {
+	samples := uint64(len(m.sizes)) * 1024
+	duration := u32(uint32(samples * 1000 / uint64(m.config.SampleRate)))
+	matrix := []byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0}
+	mvhd := mp4Box("mvhd", u32(0), u32(0), u32(0), u32(1000), duration,
+		u32(0x00010000), []byte{1, 0}, make([]byte, 10), matrix, make([]byte, 24), u32(2))
+	tkhd := mp4Box("tkhd", u32(3), u32(0), u32(0), u32(1), u32(0), duration,
+		make([]byte, 8), []byte{0, 0, 0, 0, 1, 0, 0, 0}, matrix, u32(0), u32(0))
+	mdhd := mp4Box("mdhd", u32(0), u32(0), u32(0), u32(uint32(m.config.SampleRate)), u32(uint32(samples)), []byte{0x55, 0xc4, 0, 0})
+	hdlr := mp4Box("hdlr", u32(0), u32(0), []byte("soun"), make([]byte, 12), []byte("SoundHandler\x00"))
+	smhd := mp4Box("smhd", u32(0), u32(0))
+	dinf := mp4Box("dinf", mp4Box("dref", u32(0), u32(1), mp4Box("url ", u32(1))))
+
+	raw := m.config.Raw
+	decoderConfig := append([]byte{0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, mp4Descriptor(5, raw)...)
+	es := append([]byte{0, 0, 0}, mp4Descriptor(4, decoderConfig)...)
+	es = append(es, mp4Descriptor(6, []byte{2})...)
+	esds := mp4Box("esds", u32(0), mp4Descriptor(3, es))
+	mp4a := mp4Box("mp4a", make([]byte, 6), []byte{0, 1}, make([]byte, 8),
+		[]byte{0, m.config.Channels, 0, 16, 0, 0, 0, 0}, u32(uint32(m.config.SampleRate)<<16), esds)
+	stsd := mp4Box("stsd", u32(0), u32(1), mp4a)
+	stts := mp4Box("stts", u32(0), u32(1), u32(uint32(len(m.sizes))), u32(1024))
+	stsc := mp4Box("stsc", u32(0), u32(1), u32(1), u32(uint32(len(m.sizes))), u32(1))
+	sizes := make([]byte, 4*len(m.sizes))
+	for i, size := range m.sizes {
+		binary.BigEndian.PutUint32(sizes[4*i:], size)
+	}
+	stsz := mp4Box("stsz", u32(0), u32(0), u32(uint32(len(m.sizes))), sizes)
+	offset := make([]byte, 8)
+	binary.BigEndian.PutUint64(offset, uint64(m.start+16))
+	co64 := mp4Box("co64", u32(0), u32(1), offset)
+	stbl := mp4Box("stbl", stsd, stts, stsc, stsz, co64)
+
+	minf := mp4Box("minf", smhd, dinf, stbl)
+	mdia := mp4Box("mdia", mdhd, hdlr, minf)
+	return mp4Box("moov", mvhd, mp4Box("trak", tkhd, mdia))
+}
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	box := append(u32(0), typ...)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	binary.BigEndian.PutUint32(box, uint32(len(box)))
+	return box
+}
+
+// mp4Descriptor returns MPEG-4 descriptor of tag, for data shorter than 128
+// bytes.
+func mp4Descriptor(tag byte, data []byte) []byte {
+	return append([]byte{tag, byte(len(data))}, data...)
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
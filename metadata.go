@@ -0,0 +1,230 @@
+package dylive
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Orientations of live streams.
+const (
+	OrientationLandscape = "landscape"
+	OrientationPortrait  = "portrait"
+)
+
+type (
+	// StreamInfo describes the video of one stream quality.
+	StreamInfo struct {
+		Codec   string `json:"codec,omitempty"`   // h264 or h265
+		Bitrate int64  `json:"bitrate,omitempty"` // bits per second
+		Width   int    `json:"width,omitempty"`
+		Height  int    `json:"height,omitempty"`
+	}
+
+	dyliveSdkData struct {
+		PullData struct {
+			StreamData string `json:"stream_data"` // JSON string of dyliveStreamData
+			Options    struct {
+				Qualities []struct {
+					SdkKey     string `json:"sdk_key"`
+					VCodec     string `json:"v_codec"`
+					Resolution string `json:"resolution"`
+					VBitRate   int64  `json:"v_bit_rate"`
+				} `json:"qualities"`
+			} `json:"options"`
+		} `json:"pull_data"`
+	}
+
+	dyliveStreamData struct {
+		Data map[string]struct {
+			Main struct {
+				Flv       string `json:"flv"`
+				Hls       string `json:"hls"`
+				SdkParams string `json:"sdk_params"` // JSON string of dyliveSdkParams
+			} `json:"main"`
+		} `json:"data"`
+	}
+
+	dyliveSdkParams struct {
+		VCodec     string      `json:"VCodec"`
+		Resolution string      `json:"resolution"`
+		VBitrate   json.Number `json:"vbitrate"`
+	}
+)
+
+// Age returns how long the room has been live, or 0 if the start time is
+// unknown.
+func (room Room) Age() time.Duration {
+	if room.StartedAt.IsZero() {
+		return 0
+	}
+	return time.Since(room.StartedAt)
+}
+
+// Codecs returns the video codecs of all stream qualities, sorted.
+func (room Room) Codecs() (codecs []string) {
+	seen := map[string]bool{}
+	for _, info := range room.Streams {
+		if info.Codec != "" && !seen[info.Codec] {
+			seen[info.Codec] = true
+			codecs = append(codecs, info.Codec)
+		}
+	}
+	sort.Strings(codecs)
+	return
+}
+
+// BestQuality returns the quality (uhd, hd, ld, sd) of highest bitrate whose
+// codec is one of codecs, or any codec if codecs is empty. It returns empty
+// string if no stream matches.
+func (room Room) BestQuality(codecs ...string) (quality string) {
+	var best StreamInfo
+	qualities := make([]string, 0, len(room.Streams))
+	for q := range room.Streams {
+		qualities = append(qualities, q)
+	}
+	sort.Strings(qualities)
+	for _, q := range qualities {
+		info := room.Streams[q]
+		if len(codecs) > 0 && !containsString(codecs, info.Codec) {
+			continue
+		}
+		if quality == "" || info.Bitrate > best.Bitrate ||
+			(info.Bitrate == best.Bitrate && info.Width*info.Height > best.Width*best.Height) {
+			quality, best = q, info
+		}
+	}
+	return
+}
+
+// enrich fills start time, tags, orientation, like count and stream info of
+// room.
+func (r dyliveRoom) enrich(room *Room) {
+	if r.CreateTime > 0 {
+		room.StartedAt = time.Unix(r.CreateTime, 0)
+	}
+	if tag := strings.TrimSpace(r.Hashtag.Title); tag != "" {
+		room.Tags = append(room.Tags, tag)
+	}
+	room.LikeCount = r.LikeCount
+	if room.LikeCount == 0 {
+		room.LikeCount = r.Stats.LikeCount
+	}
+	room.Streams = r.StreamUrl.LiveCoreSdkData.streams(room.FlvStreamUrls)
+	switch r.StreamUrl.StreamOrientation {
+	case 1:
+		room.Orientation = OrientationLandscape
+	case 2:
+		room.Orientation = OrientationPortrait
+	default:
+		for _, info := range room.Streams {
+			if info.Width > 0 && info.Height > 0 {
+				if info.Width >= info.Height {
+					room.Orientation = OrientationLandscape
+				} else {
+					room.Orientation = OrientationPortrait
+				}
+				break
+			}
+		}
+	}
+}
+
+// streams returns stream info by quality from the SDK parameters of each
+// stream and the quality options. Qualities are named after the keys of
+// flvUrls that have the same URL, so that they work with FlvUrlForQuality.
+func (d dyliveSdkData) streams(flvUrls map[string]string) map[string]StreamInfo {
+	streams := map[string]StreamInfo{}
+	qualities := map[string]string{} // sdk key to quality
+	var data dyliveStreamData
+	if d.PullData.StreamData != "" && json.Unmarshal([]byte(d.PullData.StreamData), &data) == nil {
+		for key, stream := range data.Data {
+			quality := streamQuality(key, stream.Main.Flv)
+			for k, u := range flvUrls {
+				if stream.Main.Flv != "" && urlPath(u) == urlPath(stream.Main.Flv) {
+					quality = k
+					break
+				}
+			}
+			qualities[key] = quality
+			var params dyliveSdkParams
+			if stream.Main.SdkParams == "" || json.Unmarshal([]byte(stream.Main.SdkParams), &params) != nil {
+				continue
+			}
+			info := StreamInfo{Codec: normalizeCodec(params.VCodec)}
+			info.Bitrate, _ = params.VBitrate.Int64()
+			info.Width, info.Height = parseResolution(params.Resolution)
+			streams[quality] = info
+		}
+	}
+	for _, q := range d.PullData.Options.Qualities {
+		if q.SdkKey == "" {
+			continue
+		}
+		quality, ok := qualities[q.SdkKey]
+		if !ok {
+			quality = streamQuality(q.SdkKey, "")
+		}
+		info := streams[quality]
+		if info.Codec == "" {
+			info.Codec = normalizeCodec(q.VCodec)
+		}
+		if info.Bitrate == 0 {
+			info.Bitrate = q.VBitRate
+		}
+		if info.Width == 0 {
+			info.Width, info.Height = parseResolution(q.Resolution)
+		}
+		streams[quality] = info
+	}
+	if len(streams) == 0 {
+		return nil
+	}
+	return streams
+}
+
+// urlPath returns URL without query string.
+func urlPath(u string) string {
+	if i := strings.IndexByte(u, '?'); i > -1 {
+		return u[:i]
+	}
+	return u
+}
+
+// normalizeCodec returns h264 or h265 for Douyin's codec names (264, h264,
+// 265, bytevc1, hevc), or the lower case name if unknown.
+func normalizeCodec(codec string) string {
+	codec = strings.ToLower(codec)
+	switch {
+	case strings.Contains(codec, "265"), strings.Contains(codec, "bytevc1"), strings.Contains(codec, "hevc"):
+		return "h265"
+	case strings.Contains(codec, "264"), strings.Contains(codec, "avc"):
+		return "h264"
+	}
+	return codec
+}
+
+// parseResolution parses resolution like 1920x1080.
+func parseResolution(resolution string) (width, height int) {
+	parts := strings.Split(strings.ToLower(resolution), "x")
+	if len(parts) != 2 {
+		return
+	}
+	w, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	h, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil {
+		return 0, 0
+	}
+	return w, h
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
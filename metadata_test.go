@@ -0,0 +1,65 @@
+package dylive
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRoomMetadata(t *testing.T) {
+	streamData, _ := json.Marshal(map[string]interface{}{
+		"data": map[string]interface{}{
+			"origin": map[string]interface{}{"main": map[string]string{
+				"flv":        "https://a/stream-1_or4.flv",
+				"sdk_params": `{"VCodec":"bytevc1","resolution":"1920x1080","vbitrate":6000000}`,
+			}},
+			"hd": map[string]interface{}{"main": map[string]string{
+				"flv":        "https://a/stream-1_hd.flv",
+				"sdk_params": `{"VCodec":"h264","resolution":"1280x720","vbitrate":2500000}`,
+			}},
+			"sd": map[string]interface{}{"main": map[string]string{
+				"flv":        "https://a/stream-1_sd.flv",
+				"sdk_params": `{"VCodec":"h264","resolution":"854x480","vbitrate":1000000}`,
+			}},
+		},
+	})
+	info := `{"web_rid":"123","room":{"id_str":"1","status":2,"create_time":1700000000,"like_count":42,` +
+		`"hashtag":{"title":"游戏"},"stream_url":{"stream_orientation":2,` +
+		`"flv_pull_url":{"FULL_HD1":"https://a/stream-1_or4.flv?expire=1","HD1":"https://a/stream-1_hd.flv?expire=1"},` +
+		`"live_core_sdk_data":{"pull_data":{` +
+		`"options":{"qualities":[{"sdk_key":"origin","v_codec":"265","v_bit_rate":1},{"sdk_key":"ld","v_codec":"264","resolution":"640x360","v_bit_rate":500000}]},` +
+		`"stream_data":` + jsonString(string(streamData)) + `}}}}}`
+	var data dyliveRoomInfo
+	if err := json.Unmarshal([]byte(info), &data); err != nil {
+		t.Fatal(err)
+	}
+	room := data.room()
+	if room.StartedAt.Unix() != 1700000000 || room.Age() <= 0 {
+		t.Errorf("wrong start time: %s", room.StartedAt)
+	}
+	if len(room.Tags) != 1 || room.Tags[0] != "游戏" || room.LikeCount != 42 || room.Orientation != OrientationPortrait {
+		t.Errorf("wrong room: %+v", room)
+	}
+	if s := room.Streams["uhd"]; s.Codec != "h265" || s.Width != 1920 || s.Height != 1080 || s.Bitrate != 6000000 {
+		t.Errorf("wrong uhd stream: %+v", s)
+	}
+	if s := room.Streams["ld"]; s.Codec != "h264" || s.Width != 640 || s.Bitrate != 500000 {
+		t.Errorf("wrong ld stream: %+v", s)
+	}
+	if codecs := room.Codecs(); len(codecs) != 2 || codecs[0] != "h264" || codecs[1] != "h265" {
+		t.Errorf("wrong codecs: %v", codecs)
+	}
+	if q := room.BestQuality(); q != "uhd" {
+		t.Errorf("best quality should be uhd instead of %s", q)
+	}
+	if q := room.BestQuality("h264"); q != "hd" {
+		t.Errorf("best h264 quality should be hd instead of %s", q)
+	}
+	if q := room.BestQuality("vp9"); q != "" {
+		t.Errorf("best vp9 quality should be empty instead of %s", q)
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
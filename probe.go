@@ -0,0 +1,335 @@
+package dylive
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+// ProbeResult is the health of a stream URL.
+type ProbeResult struct {
+	Url        string        `json:"url"`
+	Container  string        `json:"container"`             // flv or hls
+	TTFB       time.Duration `json:"ttfb"`                  // time to first byte of the stream
+	VideoCodec string        `json:"video_codec,omitempty"` // h264 or h265
+	AudioCodec string        `json:"audio_codec,omitempty"` // aac or mp3
+	Width      int           `json:"width,omitempty"`
+	Height     int           `json:"height,omitempty"`
+	Bitrate    int64         `json:"bitrate"` // measured bits per second
+}
+
+// ProbeDuration is how long of media Probe reads to measure bitrate of FLV
+// streams.
+var ProbeDuration = 2 * time.Second
+
+// String returns a short summary like "1920x1080 h264/aac 4.2Mbps 230ms".
+func (r ProbeResult) String() string {
+	var parts []string
+	if r.Width > 0 && r.Height > 0 {
+		parts = append(parts, fmt.Sprintf("%dx%d", r.Width, r.Height))
+	}
+	if codecs := strings.Trim(r.VideoCodec+"/"+r.AudioCodec, "/"); codecs != "" {
+		parts = append(parts, codecs)
+	}
+	if r.Bitrate > 0 {
+		parts = append(parts, fmt.Sprintf("%.1fMbps", float64(r.Bitrate)/1e6))
+	}
+	parts = append(parts, r.TTFB.Round(time.Millisecond).String())
+	return strings.Join(parts, " ")
+}
+
+// Probe opens the FLV or HLS stream URL and reads the header and first tags
+// or the first segment to find out its codecs, resolution and bitrate.
+func Probe(ctx context.Context, streamUrl string) (*ProbeResult, error) {
+	result := &ProbeResult{Url: streamUrl}
+	start := time.Now()
+	resp, err := getStream(ctx, streamUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+	head, err := r.Peek(3)
+	if err != nil {
+		return nil, err
+	}
+	result.TTFB = time.Since(start)
+	switch {
+	case string(head) == "FLV":
+		result.Container = "flv"
+		err = probeFlv(r, result)
+	case string(head) == "#EX":
+		result.Container = "hls"
+		err = probeHls(ctx, resp.Request.URL, r, result)
+	default:
+		err = fmt.Errorf("unknown stream format of %s", streamUrl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func getStream(ctx context.Context, streamUrl string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", streamUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := MediaClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("stream server responded with %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// probeFlv reads FLV tags until codecs are known and ProbeDuration of media
+// has been read.
+func probeFlv(r io.Reader, result *ProbeResult) error {
+	fr := flv.NewReader(r)
+	var bytes int64
+	var first, last uint32
+	for {
+		tag, err := fr.Next()
+		if err != nil {
+			if (err == io.EOF || err == io.ErrUnexpectedEOF) && fr.Tags() > 0 {
+				break
+			}
+			return err
+		}
+		switch tag.Type {
+		case flv.TagAudio:
+			if result.AudioCodec == "" {
+				result.AudioCodec = flv.AudioCodec(tag.Data)
+			}
+		case flv.TagVideo:
+			codec, packetType, _, payload := flv.ParseVideo(tag.Data)
+			if result.VideoCodec == "" {
+				result.VideoCodec = flv.VideoCodec(tag.Data)
+			}
+			if result.Width == 0 && codec == "h264" && packetType == flv.PacketSequenceHeader {
+				if config, err := flv.ParseDecoderConfig(codec, payload); err == nil {
+					result.Width, result.Height = config.Width, config.Height
+				}
+			}
+		case flv.TagScript:
+			parseFlvMetadata(tag.Data, result)
+		}
+		if tag.IsMedia() {
+			if bytes == 0 {
+				first = tag.Timestamp
+			}
+			bytes += int64(11 + len(tag.Data) + 4)
+			last = tag.Timestamp
+		}
+		known := (!fr.HasVideo() || result.VideoCodec != "") && (!fr.HasAudio() || result.AudioCodec != "")
+		if elapsed := time.Duration(last-first) * time.Millisecond; (known && elapsed >= ProbeDuration) || elapsed >= 5*ProbeDuration {
+			break
+		}
+	}
+	if last > first {
+		result.Bitrate = bytes * 8 * 1000 / int64(last-first)
+	}
+	return nil
+}
+
+// parseFlvMetadata reads width, height and codecs from onMetaData.
+func parseFlvMetadata(data []byte, result *ProbeResult) {
+	meta, ok := flv.Metadata(data)
+	if !ok {
+		return
+	}
+	if v, ok := meta["width"].(float64); ok && result.Width == 0 {
+		result.Width = int(v)
+	}
+	if v, ok := meta["height"].(float64); ok && result.Height == 0 {
+		result.Height = int(v)
+	}
+	if v, ok := meta["videocodecid"].(float64); ok && result.VideoCodec == "" {
+		result.VideoCodec = flv.VideoCodec([]byte{byte(v)})
+	}
+	if v, ok := meta["audiocodecid"].(float64); ok && result.AudioCodec == "" {
+		result.AudioCodec = flv.AudioCodec([]byte{byte(v) << 4})
+	}
+}
+
+// probeHls reads the playlist, the variant playlist if it is a master
+// playlist, and the first segment.
+func probeHls(ctx context.Context, base *url.URL, r io.Reader, result *ProbeResult) error {
+	for depth := 0; ; depth++ {
+		variant, segment, duration, err := parsePlaylist(base, r, result)
+		if err != nil {
+			return err
+		}
+		if segment != nil {
+			return probeSegment(ctx, segment, duration, result)
+		}
+		if variant == nil || depth > 0 {
+			return errors.New("no segments in HLS playlist")
+		}
+		resp, err := getStream(ctx, variant.String())
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		base, r = resp.Request.URL, resp.Body
+	}
+}
+
+// parsePlaylist returns the first variant of master playlist or the first
+// segment and its duration of media playlist.
+func parsePlaylist(base *url.URL, r io.Reader, result *ProbeResult) (variant, segment *url.URL, duration float64, err error) {
+	scanner := bufio.NewScanner(r)
+	var streamInf bool
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			streamInf = true
+			for _, attr := range splitAttributes(line[len("#EXT-X-STREAM-INF:"):]) {
+				kv := strings.SplitN(attr, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				switch kv[0] {
+				case "RESOLUTION":
+					result.Width, result.Height = parseResolution(kv[1])
+				case "CODECS":
+					for _, c := range strings.Split(strings.Trim(kv[1], `"`), ",") {
+						switch c = strings.TrimSpace(c); {
+						case strings.HasPrefix(c, "avc1"):
+							result.VideoCodec = "h264"
+						case strings.HasPrefix(c, "hvc1"), strings.HasPrefix(c, "hev1"):
+							result.VideoCodec = "h265"
+						case strings.HasPrefix(c, "mp4a.40.34"):
+							result.AudioCodec = "mp3"
+						case strings.HasPrefix(c, "mp4a"):
+							result.AudioCodec = "aac"
+						}
+					}
+				}
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			duration, _ = strconv.ParseFloat(strings.SplitN(line[len("#EXTINF:"):], ",", 2)[0], 64)
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			u, err := base.Parse(line)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			if streamInf {
+				return u, nil, 0, nil
+			}
+			return nil, u, duration, nil
+		}
+	}
+	return nil, nil, 0, scanner.Err()
+}
+
+// splitAttributes splits attribute list by commas outside of quotes.
+func splitAttributes(s string) (attrs []string) {
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			attrs = append(attrs, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(attrs, s[start:])
+}
+
+// probeSegment reads MPEG-TS segment to find codecs in its PMT and measures
+// bitrate from its size and duration.
+func probeSegment(ctx context.Context, segment *url.URL, duration float64, result *ProbeResult) error {
+	resp, err := getStream(ctx, segment.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var size int64
+	pmtPid := -1
+	packet := make([]byte, 188)
+	for {
+		n, err := io.ReadFull(resp.Body, packet)
+		size += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if packet[0] != 0x47 || packet[1]&0x40 == 0 { // sync byte, payload unit start
+			continue
+		}
+		pid := int(packet[1]&0x1f)<<8 | int(packet[2])
+		payload := packet[4:]
+		if packet[3]&0x20 != 0 { // adaptation field
+			if int(payload[0])+1 >= len(payload) {
+				continue
+			}
+			payload = payload[payload[0]+1:]
+		}
+		if pid != 0 && pid != pmtPid || len(payload) < 1 || int(payload[0])+1 >= len(payload) {
+			continue
+		}
+		section := payload[payload[0]+1:] // skip pointer field
+		if len(section) < 12 {
+			continue
+		}
+		length := int(section[1]&0xf)<<8 | int(section[2])
+		if 3+length > len(section) {
+			continue
+		}
+		// both PAT and PMT have at least 9 bytes of header, 4 bytes of
+		// program or PCR PID and program info length, and CRC
+		if length < 13 {
+			return fmt.Errorf("malformed MPEG-TS section of PID %d in %s", pid, segment)
+		}
+		section = section[:3+length-4] // without CRC
+		if pid == 0 {
+			pmtPid = int(section[10]&0x1f)<<8 | int(section[11])
+			continue
+		}
+		infoLength := int(section[10]&0xf)<<8 | int(section[11])
+		if 12+infoLength > len(section) {
+			return fmt.Errorf("malformed MPEG-TS section of PID %d in %s", pid, segment)
+		}
+		for es := section[12+infoLength:]; len(es) >= 5; {
+			switch es[0] {
+			case 0x1b:
+				result.VideoCodec = "h264"
+			case 0x24:
+				result.VideoCodec = "h265"
+			case 0x0f, 0x11:
+				result.AudioCodec = "aac"
+			case 0x03, 0x04:
+				result.AudioCodec = "mp3"
+			}
+			esInfoLength := int(es[3]&0xf)<<8 | int(es[4])
+			if 5+esInfoLength > len(es) {
+				break
+			}
+			es = es[5+esInfoLength:]
+		}
+	}
+	if duration > 0 {
+		result.Bitrate = int64(float64(size*8) / duration)
+	}
+	return nil
+}
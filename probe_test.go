@@ -0,0 +1,210 @@
+package dylive
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+func TestProbe(t *testing.T) {
+	var badSegment []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/live.flv":
+			w.Write(testFlv(false))
+		case "/nometa.flv":
+			w.Write(testFlv(true))
+		case "/live.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720,CODECS=\"avc1.64001f,mp4a.40.2\"\nhd/index.m3u8\n"))
+		case "/hd/index.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXTINF:2.000,\nseg-1.ts\n#EXTINF:2.000,\nseg-2.ts\n"))
+		case "/hd/seg-1.ts":
+			w.Write(testTs())
+		case "/bad/index.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXTINF:2.000,\nseg.ts\n"))
+		case "/bad/seg.ts":
+			w.Write(badSegment)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	result, err := Probe(context.Background(), server.URL+"/live.flv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Container != "flv" || result.VideoCodec != "h265" || result.AudioCodec != "aac" ||
+		result.Width != 1920 || result.Height != 1080 || result.TTFB <= 0 {
+		t.Errorf("wrong flv result: %+v", result)
+	}
+	// 50 video tags of 1000 bytes and 50 audio tags of 100 bytes in 2 seconds
+	if result.Bitrate < 200000 || result.Bitrate > 250000 {
+		t.Errorf("wrong bitrate: %d", result.Bitrate)
+	}
+
+	result, err = Probe(context.Background(), server.URL+"/nometa.flv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.VideoCodec != "h264" || result.Width != 1920 || result.Height != 1080 {
+		t.Errorf("resolution should be read from SPS: %+v", result)
+	}
+
+	result, err = Probe(context.Background(), server.URL+"/live.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Container != "hls" || result.VideoCodec != "h265" || result.AudioCodec != "aac" ||
+		result.Width != 1280 || result.Height != 720 || result.Bitrate != 100*188*8/2 {
+		t.Errorf("wrong hls result: %+v", result)
+	}
+
+	for _, badSegment = range [][]byte{
+		testTsPacket(0, []byte{0, 0, 0xb0, 0}),
+		append(testTs()[:188], testTsPacket(0x100, []byte{0, 2, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0xe1, 1, 0xf0, 0xff, 0, 0, 0, 0})...),
+	} {
+		if _, err := Probe(context.Background(), server.URL+"/bad/index.m3u8"); err == nil {
+			t.Errorf("should return error for malformed segment %x", badSegment[:20])
+		}
+	}
+
+	if _, err := Probe(context.Background(), server.URL+"/expired.flv"); err == nil {
+		t.Error("should return error if stream does not exist")
+	}
+}
+
+// testFlv returns 2 seconds of FLV with metadata of HEVC, or with AVC
+// sequence header only.
+func testFlv(avc bool) []byte {
+	var buf bytes.Buffer
+	buf.Write(flv.Header(true, true))
+	if avc {
+		sps := testSps(1920, 1080)
+		config := []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1, byte(len(sps) >> 8), byte(len(sps))}
+		config = append(config, sps...)
+		writeFlvTag(&buf, 9, 0, append([]byte{0x17, 0, 0, 0, 0}, config...))
+	} else {
+		var meta bytes.Buffer
+		meta.Write([]byte{2, 0, 10})
+		meta.WriteString("onMetaData")
+		meta.Write([]byte{8, 0, 0, 0, 3})
+		for _, kv := range []struct {
+			key   string
+			value float64
+		}{{"width", 1920}, {"height", 1080}, {"videocodecid", 12}} {
+			binary.Write(&meta, binary.BigEndian, uint16(len(kv.key)))
+			meta.WriteString(kv.key)
+			meta.WriteByte(0)
+			binary.Write(&meta, binary.BigEndian, math.Float64bits(kv.value))
+		}
+		meta.Write([]byte{0, 0, 9})
+		writeFlvTag(&buf, 18, 0, meta.Bytes())
+	}
+	for ts := uint32(0); ts <= 2000; ts += 40 {
+		codec := byte(0x1c)
+		if avc {
+			codec = 0x17
+		}
+		writeFlvTag(&buf, 9, ts, append([]byte{codec}, make([]byte, 1000-15)...))
+		writeFlvTag(&buf, 8, ts, append([]byte{0xaf}, make([]byte, 100-15)...))
+	}
+	return buf.Bytes()
+}
+
+func writeFlvTag(buf *bytes.Buffer, typ byte, ts uint32, data []byte) {
+	buf.Write(flv.Tag{Type: typ, Timestamp: ts, Data: data}.Bytes())
+}
+
+// testSps returns baseline H.264 SPS of the resolution, which must be a
+// multiple of 16 pixels wide and of 8 pixels high.
+func testSps(width, height int) []byte {
+	w := &bitWriter{}
+	w.bits(0x67, 8) // NAL header
+	w.bits(66, 8)   // baseline profile
+	w.bits(0, 8)    // constraint flags
+	w.bits(31, 8)   // level
+	w.ue(0)         // seq_parameter_set_id
+	w.ue(0)         // log2_max_frame_num_minus4
+	w.ue(0)         // pic_order_cnt_type
+	w.ue(0)         // log2_max_pic_order_cnt_lsb_minus4
+	w.ue(1)         // max_num_ref_frames
+	w.bits(0, 1)    // gaps_in_frame_num_value_allowed_flag
+	w.ue(width/16 - 1)
+	mbs := (height + 15) / 16
+	w.ue(mbs - 1)
+	w.bits(1, 1) // frame_mbs_only_flag
+	w.bits(1, 1) // direct_8x8_inference_flag
+	if crop := mbs*16 - height; crop > 0 {
+		w.bits(1, 1)
+		w.ue(0)
+		w.ue(0)
+		w.ue(0)
+		w.ue(crop / 2)
+	} else {
+		w.bits(0, 1)
+	}
+	w.bits(0, 1) // vui_parameters_present_flag
+	w.bits(1, 1) // rbsp_stop_one_bit
+	return w.data
+}
+
+type bitWriter struct {
+	data []byte
+	n    int
+}
+
+func (w *bitWriter) bits(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>i&1) << (7 - w.n%8)
+		w.n++
+	}
+}
+
+func (w *bitWriter) ue(v int) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+// testTs returns 100 TS packets with PAT, PMT of HEVC and AAC, and null
+// packets.
+func testTs() []byte {
+	packet := testTsPacket
+	pat := []byte{0, 0, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xe1, 0, 0, 0, 0, 0}
+	pmt := []byte{0, 2, 0xb0, 23, 0, 1, 0xc1, 0, 0, 0xe1, 1, 0xf0, 0,
+		0x24, 0xe1, 1, 0xf0, 0,
+		0x0f, 0xe1, 2, 0xf0, 0,
+		0, 0, 0, 0}
+	var buf bytes.Buffer
+	buf.Write(packet(0, pat))
+	buf.Write(packet(0x100, pmt))
+	for i := 0; i < 98; i++ {
+		buf.Write(packet(0x1fff, nil))
+	}
+	return buf.Bytes()
+}
+
+// testTsPacket returns TS packet that starts payload unit of pid.
+func testTsPacket(pid int, payload []byte) []byte {
+	p := make([]byte, 188)
+	for i := range p {
+		p[i] = 0xff
+	}
+	p[0], p[1], p[2], p[3] = 0x47, 0x40|byte(pid>>8), byte(pid), 0x10
+	copy(p[4:], payload)
+	return p
+}
@@ -0,0 +1,112 @@
+package dylive
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const douyinName = "douyin"
+
+// Provider is a live stream platform.
+type Provider interface {
+	// Name returns the name of the provider used in provider:id, for
+	// example douyin.
+	Name() string
+
+	// Categories gets all live stream categories.
+	Categories(ctx context.Context) (CategoryTree, error)
+
+	// RoomsByCategory gets top live stream rooms of a category.
+	RoomsByCategory(ctx context.Context, categoryId string) ([]Room, error)
+
+	// Room gets live stream room by its ID on the platform.
+	Room(ctx context.Context, id string) (*Room, error)
+
+	// Resolve gets live stream room by ID, URL or share link.
+	Resolve(ctx context.Context, input string) (*Room, error)
+}
+
+// Douyin is the provider of live.douyin.com.
+var Douyin Provider = douyin{}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{douyinName: Douyin}
+)
+
+type douyin struct{}
+
+func (douyin) Name() string { return douyinName }
+
+func (douyin) Categories(ctx context.Context) (CategoryTree, error) {
+	return GetCategories(ctx)
+}
+
+func (douyin) RoomsByCategory(ctx context.Context, categoryId string) ([]Room, error) {
+	return GetRoomsByCategory(ctx, categoryId)
+}
+
+func (douyin) Room(ctx context.Context, id string) (*Room, error) {
+	return GetRoom(ctx, id)
+}
+
+func (douyin) Resolve(ctx context.Context, input string) (*Room, error) {
+	return ResolveRoom(ctx, input)
+}
+
+// RegisterProvider makes a provider available by its name. A provider with
+// the same name is replaced.
+func RegisterProvider(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[p.Name()] = p
+}
+
+// LookupProvider returns the provider with the name.
+func LookupProvider(name string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Providers returns names of all registered providers, sorted.
+func Providers() (names []string) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// ParseProviderID splits provider:id into provider and id. Input without a
+// provider name, including URLs, belongs to Douyin. It returns error if the
+// provider name is not registered.
+func ParseProviderID(input string) (Provider, string, error) {
+	i := strings.Index(input, ":")
+	if i < 1 {
+		return Douyin, input, nil
+	}
+	name := input[:i]
+	if p, ok := LookupProvider(name); ok {
+		return p, input[i+1:], nil
+	}
+	if name == "http" || name == "https" || strings.HasPrefix(input[i+1:], "//") || !isProviderName(name) {
+		return Douyin, input, nil
+	}
+	return nil, "", fmt.Errorf("unknown provider %q, available providers: %s", name, strings.Join(Providers(), ", "))
+}
+
+func isProviderName(name string) bool {
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
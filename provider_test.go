@@ -0,0 +1,65 @@
+package dylive
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseProviderID(t *testing.T) {
+	fake := &FakeProvider{ProviderName: "test"}
+	RegisterProvider(fake)
+	cases := []struct {
+		input, provider, id string
+	}{
+		{"maidanglaodo", "douyin", "maidanglaodo"},
+		{"douyin:maidanglaodo", "douyin", "maidanglaodo"},
+		{"test:abc", "test", "abc"},
+		{"https://live.douyin.com/maidanglaodo", "douyin", "https://live.douyin.com/maidanglaodo"},
+		{"live.douyin.com:443/maidanglaodo", "douyin", "live.douyin.com:443/maidanglaodo"},
+	}
+	for _, c := range cases {
+		p, id, err := ParseProviderID(c.input)
+		if err != nil {
+			t.Errorf("%s: %s", c.input, err)
+			continue
+		}
+		if p.Name() != c.provider || id != c.id {
+			t.Errorf("%s should be %s:%s instead of %s:%s", c.input, c.provider, c.id, p.Name(), id)
+		}
+	}
+	if _, _, err := ParseProviderID("nosuchprovider:abc"); err == nil {
+		t.Error("should return error for unknown provider")
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	fake := &FakeProvider{}
+	cat := Category{Id: "1", Name: "游戏"}
+	fake.SetCategories(CategoryTree{cat})
+	fake.SetRoom(Room{Id: "1", DouyinId: "a", StatusCode: RoomStatusLiveOn, Category: &cat})
+	fake.SetRoom(Room{Id: "2", DouyinId: "b", StatusCode: RoomStatusLiveOff, Category: &cat})
+	var p Provider = fake
+	ctx := context.Background()
+	if rooms, err := p.RoomsByCategory(ctx, "1"); err != nil || len(rooms) != 1 || rooms[0].DouyinId != "a" {
+		t.Errorf("wrong rooms: %+v, %v", rooms, err)
+	}
+	if room, err := p.Resolve(ctx, "https://fake.example/b/"); err != nil || room.Id != "2" || room.Provider != "fake" {
+		t.Errorf("wrong room: %+v, %v", room, err)
+	}
+	if _, err := p.Room(ctx, "c"); err == nil {
+		t.Error("should return error if room does not exist")
+	}
+
+	c := &Cache{Dir: t.TempDir(), Provider: fake}
+	if tree, err := c.GetCategories(ctx); err != nil || len(tree) != 1 {
+		t.Errorf("wrong categories: %+v, %v", tree, err)
+	}
+	fake.SetError(errors.New("offline"))
+	if tree, err := c.GetCategories(NoCache(ctx)); err != nil || tree.FindByID("1") == nil {
+		t.Errorf("should return cached categories: %+v, %v", tree, err)
+	}
+	if _, err := c.GetRoom(ctx, "a"); err == nil {
+		t.Error("should return error if not cached")
+	}
+}
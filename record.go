@@ -0,0 +1,152 @@
+package dylive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+// Formats of Recorder.
+const (
+	RecordFlv = "flv"
+	RecordAac = "aac"
+	RecordM4a = "m4a"
+)
+
+// Recorder saves FLV stream without re-encoding, either as FLV with
+// onMetaData of duration, file size and keyframe index so that the file is
+// seekable, or only its AAC audio as ADTS (.aac) or M4A.
+type Recorder struct {
+	Format string // flv (default), aac or m4a
+}
+
+// RecordFormatOf returns the format of Recorder for file name by its
+// extension, defaults to flv.
+func RecordFormatOf(name string) string {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")); ext {
+	case RecordAac, RecordM4a:
+		return ext
+	}
+	return RecordFlv
+}
+
+// Record reads FLV stream from r, for example opened by StreamSource, and
+// writes it to w until r ends or ctx is done. M4A needs w to be seekable,
+// such as *os.File; so does FLV to have onMetaData written. It returns nil
+// when r ends.
+func (rec *Recorder) Record(ctx context.Context, r io.Reader, w io.Writer) error {
+	switch rec.Format {
+	case "", RecordFlv:
+		return recordFlv(ctx, r, w)
+	case RecordAac, RecordM4a:
+		return recordAudio(ctx, r, w, rec.Format)
+	}
+	return fmt.Errorf("unsupported record format: %s", rec.Format)
+}
+
+func recordFlv(ctx context.Context, r io.Reader, w io.Writer) (err error) {
+	fw := flv.NewWriter(w)
+	defer func() {
+		if cerr := fw.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return readStream(ctx, r, fw.WriteTag)
+}
+
+// readStream reads FLV stream from r and calls f with each tag, with
+// timestamps kept increasing and video frames skipped until the next
+// keyframe after reconnecting, until r ends or ctx is done. It returns nil
+// when r ends.
+func readStream(ctx context.Context, r io.Reader, f func(flv.Tag) error) error {
+	fr := flv.NewReader(r)
+	var timeline flv.Timeline
+	resets := 0
+	waitKeyframe := false
+	for ctx.Err() == nil {
+		tag, err := fr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// frames after reconnecting depend on the keyframe to come
+		if fr.Resets() != resets {
+			resets = fr.Resets()
+			waitKeyframe = fr.HasVideo()
+		}
+		if tag.Type == flv.TagVideo && !tag.IsSequenceHeader() {
+			if tag.IsKeyframe() {
+				waitKeyframe = false
+			} else if waitKeyframe {
+				continue
+			}
+		}
+		timeline.Fix(&tag, resets)
+		if err := f(tag); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func recordAudio(ctx context.Context, r io.Reader, w io.Writer, format string) (err error) {
+	var m4a *m4aWriter
+	if format == RecordM4a {
+		if m4a, err = newM4aWriter(w); err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := m4a.close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+	fr := flv.NewReader(r)
+	var config *flv.AACConfig
+	frames := 0
+	for ctx.Err() == nil {
+		tag, err := fr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if tag.Type != flv.TagAudio || len(tag.Data) < 2 {
+			continue
+		}
+		if flv.AudioCodec(tag.Data) != "aac" {
+			return fmt.Errorf("audio is not AAC but of sound format %d", tag.Data[0]>>4)
+		}
+		if tag.IsSequenceHeader() {
+			if config, err = flv.ParseAACConfig(tag.Data[2:]); err != nil {
+				return err
+			}
+			continue
+		}
+		if config == nil {
+			continue
+		}
+		if m4a != nil {
+			err = m4a.writeFrame(config, tag.Data[2:])
+		} else {
+			_, err = w.Write(config.ADTS(tag.Data[2:]))
+		}
+		if err != nil {
+			return err
+		}
+		frames++
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if frames == 0 {
+		return errors.New("stream has no AAC audio")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package dylive
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+func TestRecorder(t *testing.T) {
+	stream := append(testRtmpFlv(), testRelayFlv()...) // reconnected once
+	dir := t.TempDir()
+
+	file, err := os.Create(filepath.Join(dir, "test.flv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := (&Recorder{}).Record(context.Background(), bytes.NewReader(stream), file); err != nil {
+		t.Fatal(err)
+	}
+	file.Seek(0, io.SeekStart)
+	fr := flv.NewReader(file)
+	tag, _ := fr.Next()
+	meta, ok := flv.Metadata(tag.Data)
+	if !ok || meta["width"] != float64(1280) || meta["duration"] != 7.921 {
+		t.Errorf("wrong metadata, duration %v", meta["duration"])
+	}
+	var last uint32
+	for {
+		tag, err := fr.Next()
+		if err != nil {
+			break
+		}
+		if tag.Timestamp < last {
+			t.Fatalf("timestamp %d goes back from %d", tag.Timestamp, last)
+		}
+		last = tag.Timestamp
+	}
+
+	var aac bytes.Buffer
+	if err := (&Recorder{Format: RecordAac}).Record(context.Background(), bytes.NewReader(stream), &aac); err != nil {
+		t.Fatal(err)
+	}
+	frame := []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x5f, 0xfc, 0x21, 0x10, 0x04}
+	if !bytes.Equal(aac.Bytes(), bytes.Repeat(frame, 200)) {
+		t.Errorf("wrong ADTS stream of %d bytes", aac.Len())
+	}
+
+	file, err = os.Create(filepath.Join(dir, "test.m4a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := (&Recorder{Format: RecordM4a}).Record(context.Background(), bytes.NewReader(stream), file); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(file.Name())
+	var boxes []string
+	for pos := 0; pos+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		if size == 1 {
+			size = int(binary.BigEndian.Uint64(data[pos+8:]))
+		}
+		boxes = append(boxes, string(data[pos+4:pos+8]))
+		if size < 8 {
+			break
+		}
+		pos += size
+	}
+	if len(boxes) != 3 || boxes[0] != "ftyp" || boxes[1] != "mdat" || boxes[2] != "moov" {
+		t.Errorf("wrong boxes %v", boxes)
+	}
+	if !bytes.Contains(data, bytes.Repeat([]byte{0x21, 0x10, 0x04}, 200)) || !bytes.Contains(data, []byte("esds")) {
+		t.Error("M4A should contain frames and AAC config")
+	}
+
+	if err := (&Recorder{Format: RecordM4a}).Record(context.Background(), bytes.NewReader(stream), &aac); err == nil {
+		t.Error("should return error for M4A of non-seekable writer")
+	}
+	var changed bytes.Buffer
+	changed.Write(flv.Header(true, false))
+	for _, config := range [][]byte{{0x12, 0x10}, {0x11, 0x90}} { // 44100 Hz then 48000 Hz
+		changed.Write(flv.Tag{Type: flv.TagAudio, Data: append([]byte{0xaf, 0}, config...)}.Bytes())
+		changed.Write(flv.Tag{Type: flv.TagAudio, Data: []byte{0xaf, 1, 0x21, 0x10, 0x04}}.Bytes())
+	}
+	file, err = os.Create(filepath.Join(dir, "changed.m4a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := (&Recorder{Format: RecordM4a}).Record(context.Background(), bytes.NewReader(changed.Bytes()), file); err == nil {
+		t.Error("should return error for M4A of changed AAC config")
+	}
+	if data, _ := os.ReadFile(file.Name()); !bytes.Contains(data, []byte("moov")) {
+		t.Error("M4A of changed AAC config should still be closed")
+	}
+	if err := (&Recorder{Format: RecordAac}).Record(context.Background(), bytes.NewReader(changed.Bytes()), io.Discard); err != nil {
+		t.Errorf("ADTS of changed AAC config should be written: %v", err)
+	}
+
+	var noAudio bytes.Buffer
+	noAudio.Write(flv.Header(false, true))
+	noAudio.Write(flv.Tag{Type: flv.TagVideo, Data: []byte{0x17, 1, 0, 0, 0}}.Bytes())
+	if err := (&Recorder{Format: RecordAac}).Record(context.Background(), &noAudio, io.Discard); err == nil {
+		t.Error("should return error for stream without audio")
+	}
+}
+
+func TestRecordFormatOf(t *testing.T) {
+	for name, format := range map[string]string{
+		"a/b.flv": "flv",
+		"b.AAC":   "aac",
+		"b.m4a":   "m4a",
+		"b":       "flv",
+	} {
+		if f := RecordFormatOf(name); f != format {
+			t.Errorf("format of %s should be %s instead of %s", name, format, f)
+		}
+	}
+}
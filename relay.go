@@ -0,0 +1,377 @@
+package dylive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+// Relay pulls one upstream FLV stream per room and serves it to any number
+// of clients over HTTP:
+//
+//	/{DouyinId}.flv         FLV, starting at the latest keyframe
+//	/{DouyinId}.m3u8        HLS playlist
+//	/{DouyinId}/{seq}.ts    HLS segment
+//
+// The upstream is opened on the first request of a room and closed after
+// the room has had no clients for IdleTimeout.
+type Relay struct {
+	Quality         string        // uhd, hd, ld or sd, defaults to the default stream of room
+	IdleTimeout     time.Duration // defaults to 30 seconds
+	SegmentDuration time.Duration // target duration of HLS segments, defaults to 2 seconds
+	Segments        int           // number of HLS segments in playlist, defaults to 6
+
+	// GetRoom gets the room, defaults to GetRoom.
+	GetRoom func(ctx context.Context, douyinId string) (*Room, error)
+
+	mu    sync.Mutex
+	rooms map[string]*relayRoom
+}
+
+type relayRoom struct {
+	id     string
+	cancel context.CancelFunc
+	ready  chan struct{} // closed when upstream is opened or failed
+	done   chan struct{} // closed when upstream is closed
+	err    error
+
+	mu         sync.Mutex
+	closed     bool
+	header     []byte
+	meta       []byte
+	videoSeq   []byte
+	audioSeq   []byte
+	gop        [][]byte
+	clients    map[chan []byte]bool
+	lastActive time.Time
+	hls        *hlsMuxer
+	segmented  chan struct{} // closed and replaced when a segment is completed
+}
+
+// relayClientBuffer is the number of tags a client can fall behind before it
+// is disconnected.
+const relayClientBuffer = 1024
+
+func (relay *Relay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case strings.HasSuffix(path, ".flv") && !strings.Contains(path, "/"):
+		relay.serveFlv(w, r, strings.TrimSuffix(path, ".flv"))
+	case strings.HasSuffix(path, ".m3u8") && !strings.Contains(path, "/"):
+		relay.servePlaylist(w, r, strings.TrimSuffix(path, ".m3u8"))
+	case strings.HasSuffix(path, ".ts") && strings.Count(path, "/") == 1:
+		i := strings.Index(path, "/")
+		seq, err := strconv.Atoi(strings.TrimSuffix(path[i+1:], ".ts"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		relay.serveSegment(w, r, path[:i], seq)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Close closes all upstream streams.
+func (relay *Relay) Close() error {
+	relay.mu.Lock()
+	rooms := relay.rooms
+	relay.rooms = nil
+	relay.mu.Unlock()
+	for _, room := range rooms {
+		room.cancel()
+		<-room.done
+	}
+	return nil
+}
+
+// open returns the room with upstream opened, starting it if needed.
+func (relay *Relay) open(ctx context.Context, id string) (*relayRoom, error) {
+	relay.mu.Lock()
+	room, ok := relay.rooms[id]
+	if !ok {
+		if relay.rooms == nil {
+			relay.rooms = map[string]*relayRoom{}
+		}
+		room = &relayRoom{
+			id:         id,
+			ready:      make(chan struct{}),
+			done:       make(chan struct{}),
+			clients:    map[chan []byte]bool{},
+			lastActive: time.Now(),
+			segmented:  make(chan struct{}),
+		}
+		relay.rooms[id] = room
+		roomCtx, cancel := context.WithCancel(context.Background())
+		room.cancel = cancel
+		go relay.run(roomCtx, room)
+	}
+	relay.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-room.ready:
+	}
+	if room.err != nil {
+		return nil, room.err
+	}
+	return room, nil
+}
+
+func (relay *Relay) run(ctx context.Context, room *relayRoom) {
+	defer func() {
+		room.cancel()
+		relay.mu.Lock()
+		if relay.rooms[room.id] == room {
+			delete(relay.rooms, room.id)
+		}
+		relay.mu.Unlock()
+		room.mu.Lock()
+		room.closed = true
+		for c := range room.clients {
+			close(c)
+			delete(room.clients, c)
+		}
+		room.mu.Unlock()
+		close(room.done)
+	}()
+	src := &StreamSource{DouyinId: room.id, Quality: relay.Quality, GetRoom: relay.GetRoom}
+	r, err := src.Open(ctx)
+	if err != nil {
+		room.err = err
+		close(room.ready)
+		return
+	}
+	defer r.Close()
+	close(room.ready)
+	go relay.closeIdle(ctx, room)
+
+	fr := flv.NewReader(r)
+	var timeline flv.Timeline
+	for {
+		tag, err := fr.Next()
+		if err != nil {
+			return
+		}
+		timeline.Fix(&tag, fr.Resets())
+		room.write(fr, tag, relay)
+	}
+}
+
+func (relay *Relay) closeIdle(ctx context.Context, room *relayRoom) {
+	idle := relay.IdleTimeout
+	if idle <= 0 {
+		idle = 30 * time.Second
+	}
+	ticker := time.NewTicker(idle / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			room.mu.Lock()
+			isIdle := len(room.clients) == 0 && time.Since(room.lastActive) >= idle
+			room.mu.Unlock()
+			if isIdle {
+				room.cancel()
+				return
+			}
+		}
+	}
+}
+
+// write caches the tag and sends it to clients.
+func (room *relayRoom) write(fr *flv.Reader, tag flv.Tag, relay *Relay) {
+	b := tag.Bytes()
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	room.header = flv.Header(fr.HasAudio(), fr.HasVideo())
+	switch {
+	case tag.Type == flv.TagScript:
+		room.meta = b
+	case tag.IsSequenceHeader() && tag.Type == flv.TagVideo:
+		room.videoSeq = b
+	case tag.IsSequenceHeader():
+		room.audioSeq = b
+	case tag.IsKeyframe():
+		room.gop = [][]byte{b}
+	case len(room.gop) > 0:
+		room.gop = append(room.gop, b)
+	}
+	for c := range room.clients {
+		select {
+		case c <- b:
+		default: // too slow
+			close(c)
+			delete(room.clients, c)
+		}
+	}
+	if room.hls == nil {
+		size := relay.Segments
+		if size <= 0 {
+			size = 6
+		}
+		room.hls = newHlsMuxer(relay.segmentDuration(), size, fr.HasVideo(), fr.HasAudio())
+	}
+	if room.hls.write(tag) {
+		close(room.segmented)
+		room.segmented = make(chan struct{})
+	}
+}
+
+// subscribe returns a channel of tags and data a new client should start
+// with: FLV header, metadata, sequence headers and tags since the latest
+// keyframe.
+func (room *relayRoom) subscribe() (chan []byte, []byte) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	c := make(chan []byte, relayClientBuffer)
+	if room.closed {
+		close(c)
+		return c, nil
+	}
+	header := room.header
+	if header == nil {
+		header = flv.Header(true, true)
+	}
+	initial := append([]byte{}, header...)
+	initial = append(initial, room.meta...)
+	initial = append(initial, room.videoSeq...)
+	initial = append(initial, room.audioSeq...)
+	for _, b := range room.gop {
+		initial = append(initial, b...)
+	}
+	room.clients[c] = true
+	room.lastActive = time.Now()
+	return c, initial
+}
+
+func (room *relayRoom) unsubscribe(c chan []byte) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.clients[c] {
+		delete(room.clients, c)
+		close(c)
+	}
+	room.lastActive = time.Now()
+}
+
+func (relay *Relay) serveFlv(w http.ResponseWriter, r *http.Request, id string) {
+	room, err := relay.open(r.Context(), id)
+	if err != nil {
+		relayError(w, err)
+		return
+	}
+	c, initial := room.subscribe()
+	defer room.unsubscribe(c)
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "video/x-flv")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := w.Write(initial); err != nil {
+		return
+	}
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case b, ok := <-c:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(b); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (relay *Relay) servePlaylist(w http.ResponseWriter, r *http.Request, id string) {
+	room, err := relay.open(r.Context(), id)
+	if err != nil {
+		relayError(w, err)
+		return
+	}
+	// the first segment is ready after at most 2 target durations of media
+	timeout := time.NewTimer(5 * relay.segmentDuration())
+	defer timeout.Stop()
+	for {
+		room.mu.Lock()
+		room.lastActive = time.Now()
+		var playlist string
+		if room.hls != nil && len(room.hls.segments) > 0 {
+			playlist = room.hls.playlist(id + "/")
+		}
+		segmented := room.segmented
+		room.mu.Unlock()
+		if playlist != "" {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Header().Set("Cache-Control", "no-cache")
+			io.WriteString(w, playlist)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-room.done:
+			http.Error(w, "stream ended", http.StatusNotFound)
+			return
+		case <-timeout.C:
+			http.Error(w, "no segments", http.StatusGatewayTimeout)
+			return
+		case <-segmented:
+		}
+	}
+}
+
+func (relay *Relay) serveSegment(w http.ResponseWriter, r *http.Request, id string, seq int) {
+	relay.mu.Lock()
+	room := relay.rooms[id]
+	relay.mu.Unlock()
+	if room == nil {
+		http.NotFound(w, r)
+		return
+	}
+	room.mu.Lock()
+	room.lastActive = time.Now()
+	var data []byte
+	if room.hls != nil {
+		if s := room.hls.segment(seq); s != nil {
+			data = s.Data
+		}
+	}
+	room.mu.Unlock()
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Write(data)
+}
+
+func (relay *Relay) segmentDuration() time.Duration {
+	if relay.SegmentDuration > 0 {
+		return relay.SegmentDuration
+	}
+	return 2 * time.Second
+}
+
+func relayError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	if errors.Is(err, io.EOF) {
+		status = http.StatusNotFound
+	} else if errors.Is(err, context.Canceled) {
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
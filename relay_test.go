@@ -0,0 +1,227 @@
+package dylive
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+func TestRelay(t *testing.T) {
+	start := make(chan struct{})
+	var connections int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&connections, 1)
+		w.Header().Set("Content-Type", "video/x-flv")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if n == 1 {
+			<-start
+			w.Write(testRelayFlv())
+			return // reconnect with timestamps from 0 again
+		}
+		w.Write(testRelayFlv())
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	relay := &Relay{
+		Quality:         "hd",
+		IdleTimeout:     100 * time.Millisecond,
+		SegmentDuration: 500 * time.Millisecond,
+		GetRoom: func(ctx context.Context, douyinId string) (*Room, error) {
+			return &Room{
+				StatusCode:    RoomStatusLiveOn,
+				FlvStreamUrls: map[string]string{"hd": upstream.URL + "/" + douyinId + ".flv"},
+			}, nil
+		},
+	}
+	defer relay.Close()
+	server := httptest.NewServer(relay)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/abc.flv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	close(start)
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("relay responded with %s: %s", resp.Status, b)
+	}
+	fr := flv.NewReader(resp.Body)
+	var last uint32
+	sawKeyframe := false
+	for last < 5000 {
+		tag, err := fr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag.IsSequenceHeader() {
+			continue
+		}
+		if !sawKeyframe && tag.Type == flv.TagVideo && !tag.IsKeyframe() {
+			t.Fatal("first video tag should be keyframe")
+		}
+		sawKeyframe = sawKeyframe || tag.IsKeyframe()
+		if tag.Timestamp < last {
+			t.Fatalf("timestamp should not go back from %d to %d", last, tag.Timestamp)
+		}
+		last = tag.Timestamp
+	}
+	if fr.Resets() != 0 {
+		t.Error("relay should not send new FLV header after reconnecting")
+	}
+
+	// new client starts at latest keyframe
+	resp2, err := http.Get(server.URL + "/abc.flv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr2 := flv.NewReader(resp2.Body)
+	for i := 0; i < 3; i++ {
+		tag, err := fr2.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 2 && !tag.IsKeyframe() {
+			t.Error("new client should start with sequence headers and keyframe")
+		}
+	}
+	resp2.Body.Close()
+
+	result, err := Probe(context.Background(), server.URL+"/abc.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Container != "hls" || result.VideoCodec != "h264" || result.AudioCodec != "aac" {
+		t.Errorf("wrong hls result: %+v", result)
+	}
+	playlist, _ := getBody(server.URL + "/abc.m3u8")
+	if !bytes.Contains(playlist, []byte("#EXTINF:1.000,\nabc/")) {
+		t.Errorf("segments should be cut at keyframes: %s", playlist)
+	}
+	segment, _ := getBody(server.URL + "/abc/3.ts")
+	if len(segment) == 0 || len(segment)%188 != 0 {
+		t.Errorf("wrong segment size %d", len(segment))
+	}
+
+	resp.Body.Close()
+	for i := 0; ; i++ {
+		relay.mu.Lock()
+		n := len(relay.rooms)
+		relay.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if i == 50 {
+			t.Fatal("idle room should be closed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if connections := atomic.LoadInt32(&connections); connections != 2 {
+		t.Errorf("should connect upstream 2 times instead of %d", connections)
+	}
+}
+
+func TestHlsMuxer(t *testing.T) {
+	sps := testSps(1280, 720)
+	config := []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1, byte(len(sps) >> 8), byte(len(sps))}
+	config = append(append(config, sps...), 0)
+	videoSeq := flv.Tag{Type: flv.TagVideo, Data: append([]byte{0x17, 0, 0, 0, 0}, config...)}
+	audioSeq := flv.Tag{Type: flv.TagAudio, Data: []byte{0xaf, 0, 0x12, 0x10}}
+	cases := []struct {
+		name               string
+		hasVideo, hasAudio bool
+		video, audio       bool   // whether the tracks come
+		audioFrom          uint32 // timestamp of the first audio tag
+		streams            []byte // stream types in PMT of the first segment
+	}{
+		{"late audio", true, true, true, true, 320, []byte{0x1b, 0x0f}},
+		{"no video", true, true, false, true, 0, []byte{0x0f}},
+		{"no audio", true, true, true, false, 0, []byte{0x1b}},
+	}
+	for _, c := range cases {
+		m := newHlsMuxer(500*time.Millisecond, 6, c.hasVideo, c.hasAudio)
+		if c.video {
+			m.write(videoSeq)
+		}
+		for ts := uint32(0); ts < 4000; ts += 40 {
+			if c.video {
+				frame := []byte{0x27, 1, 0, 0, 0, 0, 0, 0, 3, 0x41, 0x9a, 0}
+				if ts%1000 == 0 {
+					frame = []byte{0x17, 1, 0, 0, 0, 0, 0, 0, 3, 0x65, 0x88, 0}
+				}
+				m.write(flv.Tag{Type: flv.TagVideo, Timestamp: ts, Data: frame})
+			}
+			if c.audio && ts == c.audioFrom {
+				m.write(audioSeq)
+			}
+			if c.audio && ts >= c.audioFrom {
+				m.write(flv.Tag{Type: flv.TagAudio, Timestamp: ts, Data: []byte{0xaf, 1, 0x21, 0x10, 0x04}})
+			}
+		}
+		if len(m.segments) == 0 {
+			t.Errorf("%s: should have segments", c.name)
+			continue
+		}
+		// PMT is the second packet, streams start after pointer field and
+		// 12 bytes of header
+		pmt := m.segments[0].Data[188+4+1:]
+		length := int(pmt[1]&0xf)<<8 | int(pmt[2])
+		var streams []byte
+		for es := pmt[12 : 3+length-4]; len(es) >= 5; es = es[5:] {
+			streams = append(streams, es[0])
+		}
+		if !bytes.Equal(streams, c.streams) {
+			t.Errorf("%s: PMT should have streams %x instead of %x", c.name, c.streams, streams)
+		}
+	}
+}
+
+func TestCrc32Mpeg(t *testing.T) {
+	// PAT of program 1 at PID 0x1000
+	pat := []byte{0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xf0, 0x00}
+	if crc := crc32Mpeg(pat); crc != 0x2ab104b2 {
+		t.Errorf("wrong crc %08x", crc)
+	}
+}
+
+func getBody(u string) ([]byte, error) {
+	resp, err := http.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// testRelayFlv returns 4 seconds of H.264 and AAC with keyframe every second.
+func testRelayFlv() []byte {
+	var buf bytes.Buffer
+	buf.Write(flv.Header(true, true))
+	sps := testSps(1280, 720)
+	pps := []byte{0x68, 0xce, 0x38, 0x80}
+	config := []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1, byte(len(sps) >> 8), byte(len(sps))}
+	config = append(config, sps...)
+	config = append(config, 1, byte(len(pps)>>8), byte(len(pps)))
+	config = append(config, pps...)
+	writeFlvTag(&buf, flv.TagVideo, 0, append([]byte{0x17, 0, 0, 0, 0}, config...))
+	writeFlvTag(&buf, flv.TagAudio, 0, []byte{0xaf, 0, 0x12, 0x10})
+	for ts := uint32(0); ts < 4000; ts += 40 {
+		frame := []byte{0x27, 1, 0, 0, 0, 0, 0, 0, 3, 0x41, 0x9a, 0}
+		if ts%1000 == 0 {
+			frame = []byte{0x17, 1, 0, 0, 0, 0, 0, 0, 3, 0x65, 0x88, 0}
+		}
+		writeFlvTag(&buf, flv.TagVideo, ts, frame)
+		writeFlvTag(&buf, flv.TagAudio, ts, []byte{0xaf, 1, 0x21, 0x10, 0x04})
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,202 @@
+package dylive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+// ReplayBuffer keeps FLV tags of the last minutes of a stream in memory, so
+// that they can be saved as a clip at any time. The buffer always starts at
+// a keyframe, so it can hold a bit more than Duration.
+type ReplayBuffer struct {
+	Duration time.Duration // defaults to 2 minutes
+	Room     *Room         // written to the metadata sidecar of clips
+
+	mu       sync.Mutex
+	meta     *flv.Tag
+	videoSeq *flv.Tag
+	audioSeq *flv.Tag
+	tags     []flv.Tag
+	hasVideo bool
+	lastAt   time.Time
+}
+
+// Clip describes a clip saved from ReplayBuffer. It is written as JSON
+// sidecar next to the clip.
+type Clip struct {
+	File     string    `json:"file"`
+	Room     *Room     `json:"room,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"duration"` // seconds
+	Size     int64     `json:"size"`
+}
+
+// Run reads FLV stream from r, for example opened by StreamSource, into the
+// buffer until r ends or ctx is done. It returns nil when r ends.
+func (b *ReplayBuffer) Run(ctx context.Context, r io.Reader) error {
+	return readStream(ctx, r, func(tag flv.Tag) error {
+		b.write(tag)
+		return nil
+	})
+}
+
+func (b *ReplayBuffer) write(tag flv.Tag) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastAt = time.Now()
+	switch {
+	case tag.Type == flv.TagScript:
+		if _, ok := flv.Metadata(tag.Data); ok {
+			b.meta = &tag
+		}
+		return
+	case !tag.IsMedia():
+		return
+	case tag.Type == flv.TagVideo:
+		b.hasVideo = true
+	}
+	if len(b.tags) == 0 && !tag.IsSequenceHeader() && !b.isStart(tag) {
+		b.keep(tag)
+		return
+	}
+	b.tags = append(b.tags, tag)
+
+	duration := b.Duration
+	if duration <= 0 {
+		duration = 2 * time.Minute
+	}
+	if time.Duration(tag.Timestamp-b.tags[0].Timestamp)*time.Millisecond <= duration {
+		return
+	}
+	// drop tags before the last start point that is not newer than cutoff
+	cutoff := tag.Timestamp - uint32(duration/time.Millisecond)
+	start := 0
+	for i, t := range b.tags {
+		if t.Timestamp > cutoff {
+			break
+		}
+		if b.isStart(t) {
+			start = i
+		}
+	}
+	for _, t := range b.tags[:start] {
+		b.keep(t)
+	}
+	b.tags = b.tags[start:]
+}
+
+// isStart reports whether the tag can start a clip.
+func (b *ReplayBuffer) isStart(tag flv.Tag) bool {
+	if b.hasVideo {
+		return tag.IsKeyframe()
+	}
+	return tag.Type == flv.TagAudio && !tag.IsSequenceHeader()
+}
+
+// keep remembers sequence headers of tags dropped from the buffer.
+func (b *ReplayBuffer) keep(tag flv.Tag) {
+	if !tag.IsSequenceHeader() {
+		return
+	}
+	if tag.Type == flv.TagVideo {
+		b.videoSeq = &tag
+	} else {
+		b.audioSeq = &tag
+	}
+}
+
+// Buffered returns duration of media in the buffer.
+func (b *ReplayBuffer) Buffered() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.tags) == 0 {
+		return 0
+	}
+	return time.Duration(b.tags[len(b.tags)-1].Timestamp-b.tags[0].Timestamp) * time.Millisecond
+}
+
+// Save writes the buffer to w as FLV starting at a keyframe. onMetaData of
+// duration and keyframe index is written if w is seekable.
+func (b *ReplayBuffer) Save(w io.Writer) (*Clip, error) {
+	b.mu.Lock()
+	meta, videoSeq, audioSeq := b.meta, b.videoSeq, b.audioSeq
+	start := 0
+	for ; start < len(b.tags) && !b.isStart(b.tags[start]); start++ {
+		if t := b.tags[start]; !t.IsSequenceHeader() {
+			continue
+		} else if t.Type == flv.TagVideo {
+			videoSeq = &t
+		} else {
+			audioSeq = &t
+		}
+	}
+	media := b.tags[start:]
+	end := b.lastAt
+	b.mu.Unlock()
+	if len(media) == 0 {
+		return nil, errors.New("replay buffer is empty")
+	}
+	var tags []flv.Tag
+	for _, t := range []*flv.Tag{meta, videoSeq, audioSeq} {
+		if t != nil {
+			tags = append(tags, *t)
+		}
+	}
+	tags = append(tags, media...)
+	fw := flv.NewWriter(w)
+	for _, tag := range tags {
+		if err := fw.WriteTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	if err := fw.Close(); err != nil {
+		return nil, err
+	}
+	duration := fw.Duration()
+	return &Clip{
+		Room:     b.Room,
+		Start:    end.Add(-time.Duration(duration * float64(time.Second))),
+		End:      end,
+		Duration: duration,
+		Size:     fw.Size(),
+	}, nil
+}
+
+// SaveFile saves the buffer to the file of name, with metadata sidecar of
+// the same name but .json extension. An existing file is not overwritten,
+// the clip is saved to the name with number suffix instead, see CreateFile.
+func (b *ReplayBuffer) SaveFile(name string) (*Clip, error) {
+	file, err := CreateFile(name)
+	if err != nil {
+		return nil, err
+	}
+	name = file.Name()
+	clip, err := b.Save(file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	clip.File = filepath.Base(name)
+	data, err := json.MarshalIndent(clip, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	sidecar := strings.TrimSuffix(name, filepath.Ext(name)) + ".json"
+	if err := os.WriteFile(sidecar, append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	return clip, nil
+}
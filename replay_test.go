@@ -0,0 +1,81 @@
+package dylive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+func TestReplayBuffer(t *testing.T) {
+	b := &ReplayBuffer{Duration: 2500 * time.Millisecond, Room: &Room{Id: "1"}}
+	if _, err := b.Save(&bytes.Buffer{}); err == nil {
+		t.Error("should return error for empty buffer")
+	}
+	if err := b.Run(context.Background(), bytes.NewReader(testRtmpFlv())); err != nil {
+		t.Fatal(err)
+	}
+	// keyframes are every second, the last one not newer than 2.5s before
+	// the end at 3.96s is at 1s
+	if d := b.Buffered(); d != 2960*time.Millisecond {
+		t.Errorf("should buffer 2.96s instead of %s", d)
+	}
+
+	name := filepath.Join(t.TempDir(), "clip.flv")
+	clip, err := b.SaveFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.Duration != 2.96 || clip.File != "clip.flv" || clip.Room.Id != "1" || !clip.End.After(clip.Start) {
+		t.Errorf("wrong clip %+v", clip)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	fr := flv.NewReader(file)
+	tag, _ := fr.Next()
+	if meta, ok := flv.Metadata(tag.Data); !ok || meta["width"] != float64(1280) || meta["duration"] != 2.96 {
+		t.Errorf("wrong metadata of clip")
+	}
+	var types []byte
+	for {
+		tag, err := fr.Next()
+		if err != nil {
+			break
+		}
+		if len(types) == 2 && !tag.IsKeyframe() {
+			t.Error("clip should start at keyframe")
+		}
+		types = append(types, tag.Type)
+	}
+	if len(types) < 2 || types[0] != flv.TagVideo || types[1] != flv.TagAudio {
+		t.Error("clip should start with sequence headers")
+	}
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(name), "clip.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sidecar Clip
+	if err := json.Unmarshal(data, &sidecar); err != nil || sidecar.Size != clip.Size || sidecar.Room.Id != "1" {
+		t.Errorf("wrong sidecar %s", data)
+	}
+
+	clip, err = b.SaveFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.File != "clip-1.flv" {
+		t.Errorf("existing clip should not be overwritten: %+v", clip)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(name), "clip-1.json")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,113 @@
+package dylive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var urlRegexp = regexp.MustCompile(`(?i)(https?://)?[a-z0-9.-]*(douyin|iesdouyin|amemv)\.com/[^\s"'<>，。]*`)
+
+// ResolveRoom gets live stream room by Douyin ID, sec_uid or any kind of
+// Douyin URL, for example:
+//
+//	maidanglaodo
+//	https://live.douyin.com/maidanglaodo?enter_from_merge=web_search
+//	https://v.douyin.com/xxxxxxx/ (short link, also in shared text)
+//	https://www.douyin.com/user/MS4wLjABAAAA...
+func ResolveRoom(ctx context.Context, input string) (*Room, error) {
+	input = strings.TrimSpace(input)
+	match := urlRegexp.FindString(input)
+	if match == "" {
+		if IsSecUid(input) {
+			return getRoomBySecUid(ctx, input)
+		}
+		return GetRoom(ctx, input)
+	}
+	if !strings.Contains(strings.ToLower(match), "://") {
+		match = "https://" + match
+	}
+	u, err := url.Parse(match)
+	if err != nil {
+		return nil, err
+	}
+	for redirects := 0; ; redirects++ {
+		if id, secUid := parseDouyinUrl(u); id != "" {
+			return GetRoom(ctx, id)
+		} else if secUid != "" {
+			return getRoomBySecUid(ctx, secUid)
+		}
+		if redirects > 0 {
+			break
+		}
+		if u, err = followRedirects(ctx, u.String()); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("unsupported Douyin URL: %s", match)
+}
+
+// parseDouyinUrl returns Douyin ID or sec_uid found in the URL.
+func parseDouyinUrl(u *url.URL) (id, secUid string) {
+	host := strings.ToLower(u.Hostname())
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	if host == "live.douyin.com" && len(segments) > 0 {
+		return segments[0], ""
+	}
+	for i, s := range segments {
+		if s == "live" && i+1 < len(segments) && host != "v.douyin.com" {
+			return segments[i+1], ""
+		}
+		if s == "user" && i+1 < len(segments) && IsSecUid(segments[i+1]) {
+			return "", segments[i+1]
+		}
+	}
+	for _, key := range []string{"sec_uid", "sec_user_id"} {
+		if v := u.Query().Get(key); v != "" {
+			return "", v
+		}
+	}
+	return "", ""
+}
+
+// followRedirects requests the URL and returns the final URL after
+// redirects.
+func followRedirects(ctx context.Context, rawurl string) (*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Request.URL, nil
+}
+
+// getRoomBySecUid gets live stream room of user with the sec_uid.
+func getRoomBySecUid(ctx context.Context, secUid string) (*Room, error) {
+	profile, err := getProfile(ctx, secUid)
+	if err != nil {
+		return nil, err
+	}
+	var roomData struct {
+		Owner struct {
+			WebRid string `json:"web_rid"`
+		} `json:"owner"`
+	}
+	json.Unmarshal([]byte(profile.RoomData), &roomData)
+	id := roomData.Owner.WebRid
+	if id == "" {
+		id = profile.UniqueId
+	}
+	if id == "" {
+		return nil, fmt.Errorf("user %s (%s) does not have live stream room", profile.Nickname, secUid)
+	}
+	return GetRoom(ctx, id)
+}
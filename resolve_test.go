@@ -0,0 +1,38 @@
+package dylive
+
+import (
+	"net/url"
+	"testing"
+)
+
+func Test_parseDouyinUrl(t *testing.T) {
+	cases := [][]string{
+		/* url, id, secUid */
+		{"https://live.douyin.com/maidanglaodo?enter_from_merge=web_search", "maidanglaodo", ""},
+		{"https://www.douyin.com/root/live/123456", "123456", ""},
+		{"https://www.douyin.com/user/MS4wLjABAAAAabc?vid=1", "", "MS4wLjABAAAAabc"},
+		{"https://www.iesdouyin.com/share/user/1?sec_uid=MS4wLjABAAAAdef", "", "MS4wLjABAAAAdef"},
+		{"https://webcast.amemv.com/douyin/webcast/reflow/1?sec_user_id=MS4wLjABAAAAghi", "", "MS4wLjABAAAAghi"},
+		{"https://v.douyin.com/iJKLmn/", "", ""},
+	}
+	for _, c := range cases {
+		u, _ := url.Parse(c[0])
+		id, secUid := parseDouyinUrl(u)
+		if id != c[1] || secUid != c[2] {
+			t.Errorf("parseDouyinUrl(%s) should return (%q, %q) instead of (%q, %q)", c[0], c[1], c[2], id, secUid)
+		}
+	}
+}
+
+func Test_urlRegexp(t *testing.T) {
+	cases := [][]string{
+		{"7- 长按复制此条消息，打开抖音搜索，查看TA的更多作品。 https://v.douyin.com/iJKLmn/ abc", "https://v.douyin.com/iJKLmn/"},
+		{"live.douyin.com/123", "live.douyin.com/123"},
+		{"maidanglaodo", ""},
+	}
+	for _, c := range cases {
+		if actual := urlRegexp.FindString(c[0]); actual != c[1] {
+			t.Errorf("url in %q should be %q instead of %q", c[0], c[1], actual)
+		}
+	}
+}
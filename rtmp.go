@@ -0,0 +1,537 @@
+package dylive
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+// Publisher pushes FLV stream to an RTMP server. It connects again when the
+// connection to the server is lost, continuing at the next keyframe with
+// timestamps following the last ones sent.
+type Publisher struct {
+	Url            string        // rtmp://host[:port]/app/stream, or rtmps://
+	ReconnectDelay time.Duration // defaults to 3 seconds
+	MaxReconnects  int           // 0 means unlimited
+
+	// OnError is called when the connection to the server fails and is
+	// about to be reconnected.
+	OnError func(err error)
+}
+
+// rtmpTimeout is the timeout of connecting and of each write.
+const rtmpTimeout = 10 * time.Second
+
+// Publish reads FLV stream from r, for example opened by StreamSource, and
+// pushes it until r ends or ctx is done. It returns nil when r ends.
+func (p *Publisher) Publish(ctx context.Context, r io.Reader) error {
+	fr := flv.NewReader(r)
+	var timeline flv.Timeline
+	var conn *rtmpConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	var meta, videoSeq, audioSeq *flv.Tag
+	waitKeyframe := false
+	reconnects := 0
+	// fail closes the connection and returns error if it should not
+	// reconnect
+	fail := func(err error) error {
+		if conn != nil {
+			conn.Close()
+			conn = nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		reconnects++
+		if p.MaxReconnects > 0 && reconnects > p.MaxReconnects {
+			return err
+		}
+		if p.OnError != nil {
+			p.OnError(err)
+		}
+		return nil
+	}
+	for {
+		tag, err := fr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		timeline.Fix(&tag, fr.Resets())
+		isConfig := true
+		switch {
+		case tag.Type == flv.TagScript:
+			meta = &tag
+		case tag.IsSequenceHeader() && tag.Type == flv.TagVideo:
+			videoSeq = &tag
+		case tag.IsSequenceHeader():
+			audioSeq = &tag
+		default:
+			isConfig = false
+		}
+		if conn == nil {
+			if reconnects > 0 {
+				if err := sleep(ctx, p.reconnectDelay()); err != nil {
+					return err
+				}
+			}
+			conn, err = dialRtmp(ctx, p.Url)
+			if err == nil {
+				for _, t := range []*flv.Tag{meta, videoSeq, audioSeq} {
+					if t != nil && err == nil {
+						config := *t
+						config.Timestamp = timeline.Last()
+						err = conn.writeTag(config)
+					}
+				}
+			}
+			if err != nil {
+				if err := fail(err); err != nil {
+					return err
+				}
+				continue
+			}
+			waitKeyframe = fr.HasVideo()
+			if isConfig {
+				continue
+			}
+		}
+		if waitKeyframe && !isConfig {
+			if !tag.IsKeyframe() {
+				continue
+			}
+			waitKeyframe = false
+		}
+		if err := conn.writeTag(tag); err != nil {
+			if err := fail(err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *Publisher) reconnectDelay() time.Duration {
+	if p.ReconnectDelay > 0 {
+		return p.ReconnectDelay
+	}
+	return 3 * time.Second
+}
+
+// Types of RTMP messages.
+const (
+	rtmpSetChunkSize  = 1
+	rtmpUserControl   = 4
+	rtmpCommandAmf0   = 20
+	rtmpChunkSize     = 4096
+	rtmpMaxChunkSize  = 0xffffff // larger chunks than the longest message are pointless
+	rtmpHandshakeSize = 1536
+)
+
+type rtmpMessage struct {
+	Type      byte
+	StreamId  uint32
+	Timestamp uint32
+	Data      []byte
+}
+
+type rtmpChunkStream struct {
+	timestamp uint32
+	delta     uint32
+	length    int
+	typ       byte
+	streamId  uint32
+	extended  bool
+	buf       []byte
+}
+
+type rtmpConn struct {
+	conn         net.Conn
+	r            *bufio.Reader
+	readChunk    int
+	chunkStreams map[int]*rtmpChunkStream
+
+	wmu        sync.Mutex
+	writeChunk int
+
+	streamId uint32
+	txId     float64
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newRtmpConn(conn net.Conn) *rtmpConn {
+	return &rtmpConn{
+		conn:         conn,
+		r:            bufio.NewReader(conn),
+		readChunk:    128, // default chunk size before Set Chunk Size
+		writeChunk:   128,
+		chunkStreams: map[int]*rtmpChunkStream{},
+		closed:       make(chan struct{}),
+	}
+}
+
+// dialRtmp connects to the RTMP server and starts publishing to the stream
+// of the URL.
+func dialRtmp(ctx context.Context, rawUrl string) (*rtmpConn, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "rtmp" && u.Scheme != "rtmps" {
+		return nil, fmt.Errorf("unsupported RTMP URL %s", rawUrl)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("RTMP URL %s should be rtmp://host/app/stream", rawUrl)
+	}
+	app, stream := parts[0], parts[1]
+	if u.RawQuery != "" {
+		stream += "?" + u.RawQuery
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "rtmps" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "1935")
+		}
+	}
+	dialer := &net.Dialer{Timeout: rtmpTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "rtmps" {
+		nc = tls.Client(nc, &tls.Config{ServerName: u.Hostname()})
+	}
+	c := newRtmpConn(nc)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-c.closed:
+		}
+	}()
+	nc.SetDeadline(time.Now().Add(rtmpTimeout))
+	if err := c.publish(u.Scheme+"://"+u.Host+"/"+app, app, stream); err != nil {
+		c.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("rtmp %s: %w", u.Host, err)
+	}
+	nc.SetDeadline(time.Time{})
+	go c.discard()
+	return c, nil
+}
+
+func (c *rtmpConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *rtmpConn) publish(tcUrl, app, stream string) error {
+	if err := c.handshake(); err != nil {
+		return err
+	}
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, rtmpChunkSize)
+	if err := c.writeMessage(2, rtmpMessage{Type: rtmpSetChunkSize, Data: size}); err != nil {
+		return err
+	}
+	c.writeChunk = rtmpChunkSize
+	if _, err := c.call(0, "connect", map[string]interface{}{
+		"app":      app,
+		"type":     "nonprivate",
+		"flashVer": "FMLE/3.0 (compatible; dylive)",
+		"tcUrl":    tcUrl,
+	}); err != nil {
+		return err
+	}
+	if err := c.send(0, "releaseStream", nil, stream); err != nil {
+		return err
+	}
+	if err := c.send(0, "FCPublish", nil, stream); err != nil {
+		return err
+	}
+	result, err := c.call(0, "createStream", nil)
+	if err != nil {
+		return err
+	}
+	if len(result) < 4 {
+		return errors.New("no stream id in result of createStream")
+	}
+	id, _ := result[3].(float64)
+	c.streamId = uint32(id)
+	if err := c.send(c.streamId, "publish", nil, stream, "live"); err != nil {
+		return err
+	}
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		values := flv.DecodeAMF(msg.Data)
+		if msg.Type != rtmpCommandAmf0 || len(values) < 4 || values[0] != "onStatus" {
+			continue
+		}
+		info, _ := values[3].(map[string]interface{})
+		if info["code"] == "NetStream.Publish.Start" {
+			return nil
+		}
+		if info["level"] == "error" {
+			return fmt.Errorf("%v: %v", info["code"], info["description"])
+		}
+	}
+}
+
+func (c *rtmpConn) handshake() error {
+	c1 := make([]byte, 1+rtmpHandshakeSize)
+	c1[0] = 3
+	if _, err := rand.Read(c1[9:]); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(c1); err != nil {
+		return err
+	}
+	s := make([]byte, 1+2*rtmpHandshakeSize)
+	if _, err := io.ReadFull(c.r, s); err != nil {
+		return err
+	}
+	if s[0] != 3 {
+		return fmt.Errorf("unsupported RTMP version %d", s[0])
+	}
+	_, err := c.conn.Write(s[1 : 1+rtmpHandshakeSize])
+	return err
+}
+
+// send sends command without waiting for result.
+func (c *rtmpConn) send(streamId uint32, name string, args ...interface{}) error {
+	c.txId++
+	data := flv.EncodeAMF(append([]interface{}{name, c.txId}, args...)...)
+	return c.writeMessage(3, rtmpMessage{Type: rtmpCommandAmf0, StreamId: streamId, Data: data})
+}
+
+// call sends command and returns the values of its result.
+func (c *rtmpConn) call(streamId uint32, name string, args ...interface{}) ([]interface{}, error) {
+	if err := c.send(streamId, name, args...); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type != rtmpCommandAmf0 {
+			continue
+		}
+		values := flv.DecodeAMF(msg.Data)
+		if len(values) < 2 || values[1] != c.txId {
+			continue
+		}
+		switch values[0] {
+		case "_result":
+			return values, nil
+		case "_error":
+			if len(values) > 3 {
+				if info, ok := values[3].(map[string]interface{}); ok {
+					return nil, fmt.Errorf("%s: %v: %v", name, info["code"], info["description"])
+				}
+			}
+			return nil, fmt.Errorf("%s failed", name)
+		}
+	}
+}
+
+// discard reads and drops messages from the server after publishing
+// starts, answering pings.
+func (c *rtmpConn) discard() {
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			c.Close()
+			return
+		}
+		if msg.Type == rtmpUserControl && len(msg.Data) >= 6 && binary.BigEndian.Uint16(msg.Data) == 6 {
+			pong := append([]byte{0, 7}, msg.Data[2:6]...)
+			c.writeMessage(2, rtmpMessage{Type: rtmpUserControl, Data: pong})
+		}
+	}
+}
+
+func (c *rtmpConn) writeTag(tag flv.Tag) error {
+	msg := rtmpMessage{Type: tag.Type, StreamId: c.streamId, Timestamp: tag.Timestamp, Data: tag.Data}
+	csid := 6
+	switch tag.Type {
+	case flv.TagAudio:
+		csid = 4
+	case flv.TagScript:
+		if _, ok := flv.Metadata(tag.Data); !ok {
+			return nil
+		}
+		msg.Data = append(flv.EncodeAMF("@setDataFrame"), tag.Data...)
+		csid = 5
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(rtmpTimeout))
+	return c.writeMessage(csid, msg)
+}
+
+func (c *rtmpConn) writeMessage(csid int, msg rtmpMessage) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	ts := msg.Timestamp
+	extended := ts >= 0xffffff
+	if extended {
+		ts = 0xffffff
+	}
+	size := len(msg.Data)
+	b := make([]byte, 0, 16+size+size/c.writeChunk*5)
+	b = append(b, byte(csid),
+		byte(ts>>16), byte(ts>>8), byte(ts),
+		byte(size>>16), byte(size>>8), byte(size),
+		msg.Type, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[8:], msg.StreamId)
+	if extended {
+		b = append(b, byte(msg.Timestamp>>24), byte(msg.Timestamp>>16), byte(msg.Timestamp>>8), byte(msg.Timestamp))
+	}
+	data := msg.Data
+	for {
+		n := len(data)
+		if n > c.writeChunk {
+			n = c.writeChunk
+		}
+		b = append(b, data[:n]...)
+		data = data[n:]
+		if len(data) == 0 {
+			break
+		}
+		b = append(b, 0xc0|byte(csid))
+		if extended {
+			b = append(b, byte(msg.Timestamp>>24), byte(msg.Timestamp>>16), byte(msg.Timestamp>>8), byte(msg.Timestamp))
+		}
+	}
+	_, err := c.conn.Write(b)
+	return err
+}
+
+func (c *rtmpConn) readMessage() (*rtmpMessage, error) {
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		format, csid := b>>6, int(b&0x3f)
+		switch csid {
+		case 0:
+			b, err := c.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			csid = 64 + int(b)
+		case 1:
+			b := make([]byte, 2)
+			if _, err := io.ReadFull(c.r, b); err != nil {
+				return nil, err
+			}
+			csid = 64 + int(b[0]) + int(b[1])*256
+		}
+		cs := c.chunkStreams[csid]
+		if cs == nil {
+			cs = &rtmpChunkStream{}
+			c.chunkStreams[csid] = cs
+		}
+		header := make([]byte, []int{11, 7, 3, 0}[format])
+		if _, err := io.ReadFull(c.r, header); err != nil {
+			return nil, err
+		}
+		if format < 3 {
+			ts := uint32(header[0])<<16 | uint32(header[1])<<8 | uint32(header[2])
+			cs.extended = ts == 0xffffff
+			if cs.extended {
+				if ts, err = c.readUint32(); err != nil {
+					return nil, err
+				}
+			}
+			if format == 0 {
+				cs.timestamp = ts
+			} else {
+				cs.timestamp += ts
+			}
+			cs.delta = ts
+			if format < 2 {
+				cs.length = int(header[3])<<16 | int(header[4])<<8 | int(header[5])
+				cs.typ = header[6]
+			}
+			if format == 0 {
+				cs.streamId = binary.LittleEndian.Uint32(header[7:])
+			}
+		} else {
+			if cs.extended {
+				if _, err := c.readUint32(); err != nil {
+					return nil, err
+				}
+			}
+			if len(cs.buf) == 0 {
+				cs.timestamp += cs.delta
+			}
+		}
+		n := cs.length - len(cs.buf)
+		if n > c.readChunk {
+			n = c.readChunk
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(c.r, chunk); err != nil {
+			return nil, err
+		}
+		cs.buf = append(cs.buf, chunk...)
+		if len(cs.buf) < cs.length {
+			continue
+		}
+		msg := &rtmpMessage{Type: cs.typ, StreamId: cs.streamId, Timestamp: cs.timestamp, Data: cs.buf}
+		cs.buf = nil
+		if msg.Type == rtmpSetChunkSize && len(msg.Data) >= 4 {
+			size := int(binary.BigEndian.Uint32(msg.Data) & 0x7fffffff)
+			if size < 1 {
+				return nil, fmt.Errorf("invalid RTMP chunk size %d", size)
+			}
+			if size > rtmpMaxChunkSize {
+				size = rtmpMaxChunkSize
+			}
+			c.readChunk = size
+			continue
+		}
+		return msg, nil
+	}
+}
+
+func (c *rtmpConn) readUint32() (uint32, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
@@ -0,0 +1,242 @@
+package dylive
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caiguanhao/dylive/flv"
+)
+
+func TestPublisher(t *testing.T) {
+	server := newTestRtmpServer(t)
+	defer server.ln.Close()
+	server.dropAfter = 50
+
+	r, w := io.Pipe()
+	go func() {
+		// the second copy starts from timestamp 0 again, like a reconnected
+		// upstream
+		data := append(testRtmpFlv(), testRtmpFlv()...)
+		for len(data) > 0 {
+			n := 100
+			if n > len(data) {
+				n = len(data)
+			}
+			w.Write(data[:n])
+			data = data[n:]
+			time.Sleep(time.Millisecond)
+		}
+		w.Close()
+	}()
+	errs := 0
+	p := &Publisher{
+		Url:            "rtmp://" + server.ln.Addr().String() + "/live/stream?key=1",
+		ReconnectDelay: 10 * time.Millisecond,
+		OnError:        func(err error) { errs++ },
+	}
+	if err := p.Publish(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.sessions) != 2 || errs != 1 {
+		t.Fatalf("should publish 2 times instead of %d with %d errors", len(server.sessions), errs)
+	}
+	for _, stream := range server.streams {
+		if stream != "stream?key=1" {
+			t.Errorf("wrong stream name %s", stream)
+		}
+	}
+	second := server.sessions[1]
+	if len(second) < 4 || second[0].Type != flv.TagScript || !bytes.HasPrefix(second[0].Data, flv.EncodeAMF("@setDataFrame", "onMetaData")) ||
+		second[1].Type != flv.TagVideo || second[1].Data[1] != 0 || second[2].Type != flv.TagAudio || second[2].Data[1] != 0 {
+		t.Fatal("should send metadata and sequence headers after reconnecting")
+	}
+	for _, msg := range second[3:] {
+		if msg.Type == flv.TagVideo {
+			if msg.Data[0] != 0x17 {
+				t.Error("should start at keyframe after reconnecting")
+			}
+			break
+		}
+	}
+	var last uint32
+	for _, session := range server.sessions {
+		for _, msg := range session {
+			if msg.Timestamp < last {
+				t.Fatalf("timestamp should not go back from %d to %d", last, msg.Timestamp)
+			}
+			last = msg.Timestamp
+		}
+	}
+	if last < 7900 {
+		t.Errorf("timestamps should continue after upstream reset, last is %d", last)
+	}
+}
+
+func TestRtmpChunks(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	w, r := newRtmpConn(a), newRtmpConn(b)
+	w.writeChunk, r.readChunk = 100, 100
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	messages := []rtmpMessage{
+		{Type: flv.TagVideo, StreamId: 1, Timestamp: 40, Data: data},
+		{Type: flv.TagAudio, StreamId: 1, Timestamp: 0x1000000, Data: data[:300]},
+	}
+	go func() {
+		for _, msg := range messages {
+			w.writeMessage(6, msg)
+		}
+	}()
+	for _, expected := range messages {
+		msg, err := r.readMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != expected.Type || msg.StreamId != 1 || msg.Timestamp != expected.Timestamp || !bytes.Equal(msg.Data, expected.Data) {
+			t.Errorf("wrong message of type %d at %d with %d bytes", msg.Type, msg.Timestamp, len(msg.Data))
+		}
+	}
+}
+
+func TestRtmpChunkSize(t *testing.T) {
+	for size, valid := range map[uint32]bool{0: false, 0x80000000: false, 1: true, 0x7fffffff: true} {
+		a, b := net.Pipe()
+		w, r := newRtmpConn(a), newRtmpConn(b)
+		go func(size uint32, valid bool) {
+			data := make([]byte, 4)
+			binary.BigEndian.PutUint32(data, size)
+			w.writeMessage(2, rtmpMessage{Type: rtmpSetChunkSize, Data: data})
+			if !valid {
+				return
+			}
+			w.writeChunk = int(size)
+			if size > rtmpMaxChunkSize {
+				w.writeChunk = rtmpMaxChunkSize
+			}
+			w.writeMessage(6, rtmpMessage{Type: flv.TagAudio, StreamId: 1, Data: []byte{1, 2, 3}})
+		}(size, valid)
+		msg, err := r.readMessage()
+		if !valid {
+			if err == nil {
+				t.Errorf("chunk size %d should be rejected", size)
+			}
+		} else if err != nil || !bytes.Equal(msg.Data, []byte{1, 2, 3}) || r.readChunk > rtmpMaxChunkSize {
+			t.Errorf("chunk size %d: wrong message %+v, error %v", size, msg, err)
+		}
+		a.Close()
+		b.Close()
+	}
+}
+
+func TestDialRtmpError(t *testing.T) {
+	for _, u := range []string{"http://localhost/live/a", "rtmp://localhost/live", "rtmp://localhost//a"} {
+		if _, err := dialRtmp(context.Background(), u); err == nil {
+			t.Errorf("%s should be invalid", u)
+		}
+	}
+}
+
+// testRtmpServer is a minimal RTMP server that accepts publishing and
+// records media messages of each session.
+type testRtmpServer struct {
+	ln        net.Listener
+	dropAfter int // close the first session after this many media messages
+
+	mu       sync.Mutex
+	sessions [][]rtmpMessage
+	streams  []string
+}
+
+func newTestRtmpServer(t *testing.T) *testRtmpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testRtmpServer{ln: ln}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(nc)
+		}
+	}()
+	return s
+}
+
+func (s *testRtmpServer) handle(nc net.Conn) {
+	defer nc.Close()
+	c := newRtmpConn(nc)
+	c1 := make([]byte, 1+rtmpHandshakeSize)
+	if _, err := io.ReadFull(c.r, c1); err != nil {
+		return
+	}
+	s1s2 := make([]byte, 1+2*rtmpHandshakeSize)
+	s1s2[0] = 3
+	copy(s1s2[1+rtmpHandshakeSize:], c1[1:])
+	nc.Write(s1s2)
+	if _, err := io.ReadFull(c.r, make([]byte, rtmpHandshakeSize)); err != nil {
+		return
+	}
+	s.mu.Lock()
+	session := len(s.sessions)
+	s.sessions = append(s.sessions, nil)
+	s.mu.Unlock()
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return
+		}
+		switch msg.Type {
+		case rtmpCommandAmf0:
+			values := flv.DecodeAMF(msg.Data)
+			var reply []byte
+			switch values[0] {
+			case "connect":
+				reply = flv.EncodeAMF("_result", values[1], nil, map[string]interface{}{"code": "NetConnection.Connect.Success"})
+			case "createStream":
+				reply = flv.EncodeAMF("_result", values[1], nil, 1)
+			case "publish":
+				s.mu.Lock()
+				s.streams = append(s.streams, values[3].(string))
+				s.mu.Unlock()
+				reply = flv.EncodeAMF("onStatus", 0, nil, map[string]interface{}{"level": "status", "code": "NetStream.Publish.Start"})
+			}
+			if reply != nil {
+				c.writeMessage(3, rtmpMessage{Type: rtmpCommandAmf0, Data: reply})
+			}
+		case flv.TagAudio, flv.TagVideo, flv.TagScript:
+			s.mu.Lock()
+			s.sessions[session] = append(s.sessions[session], *msg)
+			n := len(s.sessions[session])
+			s.mu.Unlock()
+			if session == 0 && n >= s.dropAfter {
+				return
+			}
+		}
+	}
+}
+
+// testRtmpFlv returns FLV of metadata and testRelayFlv.
+func testRtmpFlv() []byte {
+	var buf bytes.Buffer
+	buf.Write(flv.Header(true, true))
+	writeFlvTag(&buf, flv.TagScript, 0, flv.EncodeAMF("onMetaData", map[string]interface{}{"width": 1280, "height": 720}))
+	buf.Write(testRelayFlv()[flv.HeaderSize:])
+	return buf.Bytes()
+}
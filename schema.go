@@ -0,0 +1,75 @@
+package dylive
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SchemaVersion is the version of JSON schema of Room, User and Category,
+// see schema/v1.json.
+const SchemaVersion = 1
+
+type (
+	roomJSON     Room
+	userJSON     User
+	categoryJSON Category
+)
+
+// UnmarshalJSON decodes room in current JSON schema or in the old form that
+// uses Go field names, such as {"Id": "...", "StatusCode": 2}. Keys of stream
+// URLs in the old form are Douyin's names, such as FULL_HD1, and are changed
+// to quality names like GetRoom does.
+func (room *Room) UnmarshalJSON(data []byte) error {
+	legacy, err := unmarshalJSON(data, (*roomJSON)(room))
+	if err == nil && legacy {
+		room.FlvStreamUrls = normalizeStreamUrls(room.FlvStreamUrls)
+		room.HlsStreamUrls = normalizeStreamUrls(room.HlsStreamUrls)
+	}
+	return err
+}
+
+// UnmarshalJSON decodes user in current JSON schema or in the old form that
+// uses Go field names.
+func (user *User) UnmarshalJSON(data []byte) error {
+	_, err := unmarshalJSON(data, (*userJSON)(user))
+	return err
+}
+
+// UnmarshalJSON decodes category in current JSON schema or in the old form
+// that uses Go field names.
+func (cat *Category) UnmarshalJSON(data []byte) error {
+	_, err := unmarshalJSON(data, (*categoryJSON)(cat))
+	return err
+}
+
+// unmarshalJSON renames keys that are Go field names of target to their
+// JSON names before decoding. It reports whether data is in the old form.
+func unmarshalJSON(data []byte, target interface{}) (legacy bool, err error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil || obj == nil {
+		return false, json.Unmarshal(data, target)
+	}
+	t := reflect.TypeOf(target).Elem()
+	renamed := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == field.Name {
+			continue
+		}
+		if value, ok := obj[field.Name]; ok {
+			if _, exists := obj[name]; !exists {
+				obj[name] = value
+			}
+			delete(obj, field.Name)
+			renamed = true
+		}
+	}
+	if renamed {
+		if data, err = json.Marshal(obj); err != nil {
+			return false, err
+		}
+	}
+	return renamed, json.Unmarshal(data, target)
+}
@@ -0,0 +1,128 @@
+package dylive
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRoomJSON(t *testing.T) {
+	room := Room{
+		Id:            "1",
+		DouyinId:      "abc",
+		StatusCode:    RoomStatusLiveOn,
+		Category:      &Category{Id: "4_101", Name: "游戏"},
+		User:          User{Id: "2", Name: "A"},
+		FlvStreamUrls: normalizeStreamUrls(map[string]string{"FULL_HD1": "a_or4.flv", "HD1": "a_hd.flv"}),
+	}
+	b, err := json.Marshal(room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj map[string]interface{}
+	json.Unmarshal(b, &obj)
+	if obj["douyin_id"] != "abc" || obj["status"] != "live" {
+		t.Errorf("wrong json: %s", b)
+	}
+	if urls, _ := obj["flv_stream_urls"].(map[string]interface{}); urls["uhd"] != "a_or4.flv" || urls["hd"] != "a_hd.flv" {
+		t.Errorf("wrong stream urls: %s", b)
+	}
+	var decoded Room
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.DouyinId != "abc" || decoded.StatusCode != RoomStatusLiveOn || decoded.User.Id != "2" ||
+		decoded.Category.Name != "游戏" || decoded.FlvUrlForQuality("uhd") != "a_or4.flv" {
+		t.Errorf("wrong room: %+v", decoded)
+	}
+}
+
+func TestRoomLegacyJSON(t *testing.T) {
+	const legacy = `{"Id":"1","DouyinId":"abc","StatusCode":2,"Name":"t","CurrentUsersCount":"10",` +
+		`"Category":{"Id":"4_101","Name":"游戏","Categories":[{"Id":"4_101_1","Name":"射击","Categories":[]}]},` +
+		`"User":{"Name":"A","Picture":"a.jpg"},"StreamUrl":"s","FlvStreamUrls":{"FULL_HD1":"a_or4.flv"},"HlsStreamUrls":null}`
+	var room Room
+	if err := json.Unmarshal([]byte(legacy), &room); err != nil {
+		t.Fatal(err)
+	}
+	if room.Id != "1" || room.DouyinId != "abc" || room.StatusCode != RoomStatusLiveOn || room.Name != "t" ||
+		room.CurrentUsersCount != "10" || room.StreamUrl != "s" {
+		t.Errorf("wrong room: %+v", room)
+	}
+	if room.User.Name != "A" || room.User.Picture != "a.jpg" {
+		t.Errorf("wrong user: %+v", room.User)
+	}
+	if room.Category == nil || len(room.Category.Categories) != 1 || room.Category.Categories[0].Id != "4_101_1" {
+		t.Errorf("wrong category: %+v", room.Category)
+	}
+	if room.FlvUrlForQuality("uhd") != "a_or4.flv" {
+		t.Errorf("wrong stream urls: %+v", room.FlvStreamUrls)
+	}
+
+	// archive written by dylive before the schema, decoded the same as the
+	// room from GetRoom
+	data, err := os.ReadFile("testdata/room_v0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	room = Room{}
+	if err := json.Unmarshal(data, &room); err != nil {
+		t.Fatal(err)
+	}
+	var archived struct{ FlvStreamUrls, HlsStreamUrls map[string]string }
+	json.Unmarshal(data, &archived)
+	if expected := normalizeStreamUrls(archived.FlvStreamUrls); !reflect.DeepEqual(room.FlvStreamUrls, expected) || expected["ld"] == "" {
+		t.Errorf("flv stream urls should be %v instead of %v", expected, room.FlvStreamUrls)
+	}
+	if expected := normalizeStreamUrls(archived.HlsStreamUrls); !reflect.DeepEqual(room.HlsStreamUrls, expected) || expected["uhd"] == "" {
+		t.Errorf("hls stream urls should be %v instead of %v", expected, room.HlsStreamUrls)
+	}
+	if room.User.SecUid != "MS4wLjABAAAA" || room.Category.Categories[0].Name != "射击" {
+		t.Errorf("wrong room: %+v", room)
+	}
+}
+
+func TestSchemaFile(t *testing.T) {
+	b, err := os.ReadFile("schema/v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Definitions map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range regexp.MustCompile(`"\$ref": "#/definitions/(\w+)"`).FindAllStringSubmatch(string(b), -1) {
+		if _, ok := schema.Definitions[m[1]]; !ok {
+			t.Errorf("definition %s does not exist", m[1])
+		}
+	}
+	for name, typ := range map[string]reflect.Type{
+		"room":        reflect.TypeOf(Room{}),
+		"user":        reflect.TypeOf(User{}),
+		"category":    reflect.TypeOf(Category{}),
+		"stream_info": reflect.TypeOf(StreamInfo{}),
+	} {
+		var fields, properties []string
+		for i := 0; i < typ.NumField(); i++ {
+			if tag := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+				fields = append(fields, tag)
+			}
+		}
+		for p := range schema.Definitions[name].Properties {
+			properties = append(properties, p)
+		}
+		sort.Strings(fields)
+		sort.Strings(properties)
+		if !reflect.DeepEqual(fields, properties) {
+			t.Errorf("properties of %s should be %v instead of %v", name, fields, properties)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package dylive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session keeps cookies for requests to Douyin live pages. When there are
+// no cookies yet, it gets __ac_nonce from live.douyin.com and ttwid from
+// ByteDance like a browser does.
+type Session struct {
+	// CookieFile is an optional cookie file in Netscape format, for
+	// example exported from a browser that has logged in to Douyin.
+	CookieFile string
+
+	mu       sync.Mutex
+	jar      *cookiejar.Jar
+	ready    bool
+	initDone chan struct{} // closed when the handshake in progress is done
+}
+
+// DefaultSession is the session used by GetRoom.
+var DefaultSession = &Session{}
+
+const ttwidUrl = "https://ttwid.bytedance.com/ttwid/union/register/"
+
+var liveUrl = &url.URL{Scheme: "https", Host: "live.douyin.com", Path: "/"}
+
+// Cookies returns cookies that will be sent to the URL.
+func (s *Session) Cookies(u *url.URL) []*http.Cookie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jar == nil {
+		return nil
+	}
+	return s.jar.Cookies(u)
+}
+
+// Reset removes all cookies, so that the cookie file is loaded and the
+// handshake is done again on next request.
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jar = nil
+	s.ready = false
+}
+
+// prepare adds cookies to req, loading the cookie file and doing the
+// handshake first if needed.
+func (s *Session) prepare(ctx context.Context, req *http.Request) error {
+	jar, err := s.cookieJar(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range jar.Cookies(req.URL) {
+		req.AddCookie(c)
+	}
+	return nil
+}
+
+// cookieJar returns the cookie jar, doing the handshake first if needed.
+// The handshake is done without holding the lock, and requests during the
+// handshake wait for it instead of doing another one.
+func (s *Session) cookieJar(ctx context.Context) (*cookiejar.Jar, error) {
+	for {
+		s.mu.Lock()
+		if s.ready {
+			jar := s.jar
+			s.mu.Unlock()
+			return jar, nil
+		}
+		if done := s.initDone; done != nil {
+			s.mu.Unlock()
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		s.initDone = done
+		s.mu.Unlock()
+
+		jar, err := s.init(ctx)
+		s.mu.Lock()
+		s.initDone = nil
+		if err == nil {
+			s.jar, s.ready = jar, true
+		}
+		s.mu.Unlock()
+		close(done)
+		return jar, err
+	}
+}
+
+// update saves cookies set by the response.
+func (s *Session) update(resp *http.Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jar != nil && resp.Request != nil {
+		s.jar.SetCookies(resp.Request.URL, resp.Cookies())
+	}
+}
+
+func (s *Session) init(ctx context.Context) (*cookiejar.Jar, error) {
+	jar, _ := cookiejar.New(nil)
+	if s.CookieFile != "" {
+		cookies, err := readCookieFile(s.CookieFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cookies {
+			u := &url.URL{Scheme: "http", Host: strings.TrimPrefix(c.Domain, "."), Path: c.Path}
+			if c.Secure {
+				u.Scheme = "https"
+			}
+			if !strings.HasPrefix(c.Domain, ".") {
+				c.Domain = "" // host-only cookie
+			}
+			jar.SetCookies(u, []*http.Cookie{c})
+		}
+	}
+	if !hasCookie(jar, "__ac_nonce") {
+		if err := getNonce(ctx, jar); err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	if !hasCookie(jar, "ttwid") {
+		if err := getTtwid(ctx, jar); err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	if !hasCookie(jar, "__ac_nonce") {
+		jar.SetCookies(liveUrl, []*http.Cookie{{Name: "__ac_nonce", Value: randomNonce()}})
+	}
+	return jar, nil
+}
+
+func hasCookie(jar *cookiejar.Jar, name string) bool {
+	for _, c := range jar.Cookies(liveUrl) {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getNonce gets __ac_nonce (and maybe ttwid) from home page of live.douyin.com.
+func getNonce(ctx context.Context, jar *cookiejar.Jar) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", liveUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	jar.SetCookies(liveUrl, resp.Cookies())
+	return nil
+}
+
+// getTtwid registers a new ttwid and sets it for douyin.com.
+func getTtwid(ctx context.Context, jar *cookiejar.Jar) error {
+	body := `{"region":"cn","aid":1768,"needFid":false,"service":"www.ixigua.com",` +
+		`"migrate_info":{"ticket":"","source":"node"},"cbUrlProtocol":"https","union":true}`
+	req, err := http.NewRequestWithContext(ctx, "POST", ttwidUrl, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	for _, c := range resp.Cookies() {
+		if c.Name == "ttwid" && c.Value != "" {
+			jar.SetCookies(liveUrl, []*http.Cookie{{Name: c.Name, Value: c.Value, Domain: "douyin.com", Path: "/"}})
+		}
+	}
+	return nil
+}
+
+// randomNonce returns 21 random hex digits like a real __ac_nonce.
+func randomNonce() string {
+	b := make([]byte, 11)
+	rand.Read(b)
+	return hex.EncodeToString(b)[:21]
+}
+
+// readCookieFile reads cookies in Netscape format, which has one cookie per
+// line with tab separated domain, include subdomains, path, secure, expiry,
+// name and value. Domain of cookies for subdomains starts with a dot.
+// Expired cookies are skipped.
+func readCookieFile(file string) (cookies []*http.Cookie, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			continue
+		}
+		c := &http.Cookie{
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		c.Domain = strings.TrimPrefix(fields[0], ".")
+		if strings.EqualFold(fields[1], "TRUE") {
+			c.Domain = "." + c.Domain
+		}
+		if expiry, _ := strconv.ParseInt(fields[4], 10, 64); expiry > 0 {
+			c.Expires = time.Unix(expiry, 0)
+			if c.Expires.Before(time.Now()) {
+				continue
+			}
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, scanner.Err()
+}
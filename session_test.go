@@ -0,0 +1,60 @@
+package dylive
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	cookieFile := filepath.Join(t.TempDir(), "cookies.txt")
+	os.WriteFile(cookieFile, []byte("# Netscape HTTP Cookie File\n"+
+		"#HttpOnly_.douyin.com\tTRUE\t/\tTRUE\t0\tsessionid\tabc\n"+
+		".douyin.com\tTRUE\t/\tFALSE\t1\texpired\tx\n"+
+		"www.douyin.com\tFALSE\t/\tFALSE\t0\twww\ty\n"), 0644)
+	defer func(s *Session) { DefaultSession = s }(DefaultSession)
+	DefaultSession = &Session{CookieFile: cookieFile}
+	var handshakes, pages int
+	var cookies []string
+	defer func(c *http.Client) { HTTPClient = c }(HTTPClient)
+	HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		body := ""
+		switch {
+		case req.URL.Host == "ttwid.bytedance.com":
+			header.Add("Set-Cookie", "ttwid=tt; Domain=bytedance.com; Path=/")
+		case req.URL.Path == "/":
+			handshakes++
+			header.Add("Set-Cookie", "__ac_nonce=nonce"+string('0'+byte(handshakes))+"; Path=/")
+		default:
+			pages++
+			cookies = append(cookies, req.Header.Get("Cookie"))
+			if pages > 1 {
+				body = `<script>window.__INIT_PROPS__ = {"roomStore":{"roomInfo":{"web_rid":"abc","room":{"id_str":"1","status":2}}}}</script>`
+			} else {
+				body = "<script>window.byted_acrawler.init()</script>"
+			}
+		}
+		return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})}
+	room, err := GetRoom(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.Id != "1" {
+		t.Errorf("wrong room: %+v", room)
+	}
+	if handshakes != 2 || pages != 2 {
+		t.Errorf("should have made 2 handshakes and 2 page requests instead of %d and %d", handshakes, pages)
+	}
+	for i, expected := range []string{"nonce1", "nonce2"} {
+		if !strings.Contains(cookies[i], "sessionid=abc") || !strings.Contains(cookies[i], "__ac_nonce="+expected) ||
+			!strings.Contains(cookies[i], "ttwid=tt") || strings.Contains(cookies[i], "expired") || strings.Contains(cookies[i], "www=") {
+			t.Errorf("wrong cookies of request %d: %s", i+1, cookies[i])
+		}
+	}
+}
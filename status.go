@@ -0,0 +1,119 @@
+package dylive
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RoomStatus is the status of a live stream room. Positive values are the
+// status codes used by Douyin.
+type RoomStatus int
+
+const (
+	RoomStatusUnknown   RoomStatus = 0
+	RoomStatusPreparing RoomStatus = 1  // room is created but stream has not started
+	RoomStatusLiveOn    RoomStatus = 2  // streaming
+	RoomStatusPaused    RoomStatus = 3  // streamer has paused, usually comes back soon
+	RoomStatusLiveOff   RoomStatus = 4  // stream has ended
+	RoomStatusBanned    RoomStatus = -1 // room is banned, see RoomStatusError
+	RoomStatusNotFound  RoomStatus = -2 // room does not exist, see RoomStatusError
+
+	RoomStatusLive  = RoomStatusLiveOn
+	RoomStatusEnded = RoomStatusLiveOff
+)
+
+var roomStatusNames = map[RoomStatus]string{
+	RoomStatusUnknown:   "unknown",
+	RoomStatusPreparing: "preparing",
+	RoomStatusLiveOn:    "live",
+	RoomStatusPaused:    "paused",
+	RoomStatusLiveOff:   "ended",
+	RoomStatusBanned:    "banned",
+	RoomStatusNotFound:  "not_found",
+}
+
+func (status RoomStatus) String() string {
+	if name, ok := roomStatusNames[status]; ok {
+		return name
+	}
+	return strconv.Itoa(int(status))
+}
+
+// MarshalJSON encodes known status as its name and unknown status as number.
+func (status RoomStatus) MarshalJSON() ([]byte, error) {
+	if name, ok := roomStatusNames[status]; ok {
+		return json.Marshal(name)
+	}
+	return json.Marshal(int(status))
+}
+
+// UnmarshalJSON decodes status from its name or number.
+func (status *RoomStatus) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*status = RoomStatus(n)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for s, n := range roomStatusNames {
+		if n == name {
+			*status = s
+			return nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		*status = RoomStatus(n)
+		return nil
+	}
+	*status = RoomStatusUnknown
+	return nil
+}
+
+// RoomStatusError is returned when there is no room to get because it does
+// not exist or is banned.
+type RoomStatusError struct {
+	DouyinId string
+	Status   RoomStatus // RoomStatusNotFound or RoomStatusBanned
+}
+
+func (e *RoomStatusError) Error() string {
+	if e.Status == RoomStatusBanned {
+		return fmt.Sprintf("DouyinId %s is banned", e.DouyinId)
+	}
+	return fmt.Sprintf("DouyinId %s does not exist", e.DouyinId)
+}
+
+// bannedMarkers are texts shown by Douyin instead of a banned room.
+var bannedMarkers = []string{"已被封禁", "封禁中", "违反社区规定"}
+
+// missingRoomError returns RoomStatusError of the room that is not in the
+// page or API response, banned if text has a banned marker.
+func missingRoomError(douyinId, text string) error {
+	for _, marker := range bannedMarkers {
+		if strings.Contains(text, marker) {
+			return &RoomStatusError{DouyinId: douyinId, Status: RoomStatusBanned}
+		}
+	}
+	return &RoomStatusError{DouyinId: douyinId, Status: RoomStatusNotFound}
+}
+
+// IsLive reports whether the room is streaming.
+func (room Room) IsLive() bool {
+	return room.StatusCode == RoomStatusLiveOn
+}
+
+// IsPaused reports whether the streamer has paused the stream.
+func (room Room) IsPaused() bool {
+	return room.StatusCode == RoomStatusPaused
+}
+
+// IsOnAir reports whether the live stream session has started and not
+// ended, that is, the room is streaming or paused.
+func (room Room) IsOnAir() bool {
+	return room.IsLive() || room.IsPaused()
+}
@@ -0,0 +1,42 @@
+package dylive
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRoomStatusJSON(t *testing.T) {
+	cases := []struct {
+		status RoomStatus
+		json   string
+	}{
+		{RoomStatusLiveOn, `"live"`},
+		{RoomStatusPaused, `"paused"`},
+		{RoomStatusNotFound, `"not_found"`},
+		{RoomStatusBanned, `"banned"`},
+		{RoomStatus(9), `9`},
+	}
+	for _, c := range cases {
+		b, err := json.Marshal(c.status)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(b) != c.json {
+			t.Errorf("%d should be encoded to %s instead of %s", c.status, c.json, b)
+		}
+		var status RoomStatus
+		if err := json.Unmarshal(b, &status); err != nil {
+			t.Error(err)
+		}
+		if status != c.status {
+			t.Errorf("%s should be decoded to %d instead of %d", b, c.status, status)
+		}
+	}
+	var room Room
+	if err := json.Unmarshal([]byte(`{"StatusCode":4}`), &room); err != nil {
+		t.Error(err)
+	}
+	if room.StatusCode != RoomStatusEnded || room.IsOnAir() {
+		t.Errorf("status should be ended instead of %s", room.StatusCode)
+	}
+}
@@ -0,0 +1,220 @@
+package dylive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StreamExpiresAt returns the earliest expiry time of the stream URLs of the
+// room, or zero time if the URLs do not expire.
+func (room Room) StreamExpiresAt() (earliest time.Time) {
+	urls := []string{room.StreamUrl}
+	for _, u := range room.FlvStreamUrls {
+		urls = append(urls, u)
+	}
+	for _, u := range room.HlsStreamUrls {
+		urls = append(urls, u)
+	}
+	for _, u := range urls {
+		if t := StreamUrlExpiresAt(u); !t.IsZero() && (earliest.IsZero() || t.Before(earliest)) {
+			earliest = t
+		}
+	}
+	return
+}
+
+// StreamUrlExpiresAt returns the expiry time in the signed stream URL, from
+// its expire (unix time) or wsTime (unix time in hex) parameter. It returns
+// zero time if the URL does not expire.
+func StreamUrlExpiresAt(streamUrl string) time.Time {
+	u, err := url.Parse(streamUrl)
+	if err != nil {
+		return time.Time{}
+	}
+	q := u.Query()
+	if v := q.Get("expire"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(n, 0)
+		}
+	}
+	if v := q.Get("wsTime"); v != "" {
+		base := 16
+		if len(v) > 8 {
+			base = 10
+		}
+		if n, err := strconv.ParseInt(v, base, 64); err == nil {
+			return time.Unix(n, 0)
+		}
+	}
+	return time.Time{}
+}
+
+// StreamSource provides stream URL of a room that is always fresh. It gets
+// the room again when the URL is about to expire or is rejected by the
+// server.
+type StreamSource struct {
+	DouyinId      string
+	Quality       string        // uhd, hd, ld or sd
+	Format        string        // flv (default) or hls
+	RefreshBefore time.Duration // get new URL this long before expiry, defaults to 1 minute
+	MaxReconnects int           // maximum reconnects of Open, 0 means unlimited
+
+	// GetRoom gets the room, defaults to GetRoom.
+	GetRoom func(ctx context.Context, douyinId string) (*Room, error)
+
+	mu   sync.Mutex
+	room *Room
+}
+
+// Room returns the room last got by the source, which can be nil.
+func (s *StreamSource) Room() *Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.room
+}
+
+// URL returns the stream URL, getting the room again if the URL is about to
+// expire.
+func (s *StreamSource) URL(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	room := s.room
+	s.mu.Unlock()
+	if room != nil {
+		u := s.urlOf(room)
+		refreshBefore := s.RefreshBefore
+		if refreshBefore <= 0 {
+			refreshBefore = time.Minute
+		}
+		if exp := StreamUrlExpiresAt(u); exp.IsZero() || time.Until(exp) > refreshBefore {
+			return u, nil
+		}
+	}
+	if err := s.Refresh(ctx); err != nil {
+		return "", err
+	}
+	return s.urlOf(s.Room()), nil
+}
+
+// Refresh gets the room again.
+func (s *StreamSource) Refresh(ctx context.Context) error {
+	getRoom := s.GetRoom
+	if getRoom == nil {
+		getRoom = GetRoom
+	}
+	room, err := getRoom(ctx, s.DouyinId)
+	if err != nil {
+		return err
+	}
+	if !room.IsOnAir() {
+		return fmt.Errorf("%s (%s) is not live: %w", room.User.Name, s.DouyinId, io.EOF)
+	}
+	s.mu.Lock()
+	s.room = room
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *StreamSource) urlOf(room *Room) string {
+	if s.Format == "hls" || s.Format == "m3u8" {
+		return room.HlsUrlForQuality(s.Quality)
+	}
+	return room.FlvUrlForQuality(s.Quality)
+}
+
+// Open opens the stream. The returned reader reconnects with a fresh URL
+// when the connection is closed by the server, until the room is no longer
+// live or ctx is done. For FLV streams, each new connection starts with a
+// new FLV header.
+func (s *StreamSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	r := &streamReader{ctx: ctx, src: s}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type streamReader struct {
+	ctx        context.Context
+	src        *StreamSource
+	body       io.ReadCloser
+	reconnects int
+}
+
+func (r *streamReader) connect() error {
+	for attempt := 0; ; attempt++ {
+		u, err := r.src.URL(r.ctx)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(r.ctx, "GET", u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", userAgent)
+		resp, err := MediaClient.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusOK {
+			r.body = resp.Body
+			return nil
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+			if attempt == 0 {
+				if err := r.src.Refresh(r.ctx); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		return fmt.Errorf("stream server responded with %s", resp.Status)
+	}
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			if err := r.connect(); errors.Is(err, io.EOF) {
+				return 0, io.EOF
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.body.Read(p)
+		if n > 0 || err == nil {
+			return n, nil
+		}
+		r.body.Close()
+		r.body = nil
+		if r.ctx.Err() != nil {
+			return 0, r.ctx.Err()
+		}
+		r.reconnects++
+		if r.src.MaxReconnects > 0 && r.reconnects > r.src.MaxReconnects {
+			return 0, err
+		}
+		if r.reconnects > 1 {
+			if err := sleep(r.ctx, time.Second); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+func (r *streamReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
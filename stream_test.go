@@ -0,0 +1,79 @@
+package dylive
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStreamUrlExpiresAt(t *testing.T) {
+	cases := []struct {
+		url     string
+		expires int64
+	}{
+		{"https://pull-flv.douyincdn.com/stage/stream-1_hd.flv?expire=1700000000&sign=abc", 1700000000},
+		{"https://pull-flv.douyincdn.com/stage/stream-1_hd.flv?wsSecret=abc&wsTime=6553f100", 0x6553f100},
+		{"https://pull-flv.douyincdn.com/stage/stream-1_hd.flv?wsTime=1700000000", 1700000000},
+		{"https://pull-flv.douyincdn.com/stage/stream-1_hd.flv", 0},
+	}
+	for _, c := range cases {
+		actual := StreamUrlExpiresAt(c.url)
+		if (c.expires == 0 && !actual.IsZero()) || (c.expires != 0 && actual.Unix() != c.expires) {
+			t.Errorf("%s should expire at %d instead of %s", c.url, c.expires, actual)
+		}
+	}
+	room := Room{FlvStreamUrls: map[string]string{
+		"hd": "https://a/b_hd.flv?expire=1700000300",
+		"sd": "https://a/b_sd.flv?expire=1700000100",
+	}}
+	if room.StreamExpiresAt().Unix() != 1700000100 {
+		t.Errorf("wrong expiry: %s", room.StreamExpiresAt())
+	}
+}
+
+func TestStreamSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expire, _ := strconv.ParseInt(r.URL.Query().Get("expire"), 10, 64)
+		if time.Unix(expire, 0).Before(time.Now()) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(r.URL.Query().Get("n")))
+	}))
+	defer server.Close()
+	n := 0
+	src := &StreamSource{
+		DouyinId:      "abc",
+		Quality:       "hd",
+		MaxReconnects: 2,
+		GetRoom: func(ctx context.Context, douyinId string) (*Room, error) {
+			n++
+			expire := time.Now().Add(time.Hour)
+			if n == 1 {
+				expire = time.Now().Add(-time.Hour) // server rejects expired URL
+			}
+			return &Room{
+				StatusCode: RoomStatusLiveOn,
+				FlvStreamUrls: map[string]string{
+					"hd": server.URL + "/stream_hd.flv?n=" + strconv.Itoa(n) + "&expire=" + strconv.FormatInt(expire.Unix(), 10),
+				},
+			}, nil
+		},
+	}
+	r, err := src.Open(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, _ := ioutil.ReadAll(r)
+	if string(b) != "222" {
+		t.Errorf("should read 222 instead of %s", b)
+	}
+	if n != 2 {
+		t.Errorf("should get room 2 times instead of %d", n)
+	}
+}
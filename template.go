@@ -0,0 +1,141 @@
+package dylive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTimeFormat is the default format of TemplateData.Now.
+const DefaultTimeFormat = "2006-01-02-15-04-05"
+
+// TemplateData is the data used in command templates of dylive and dywatch.
+type TemplateData struct {
+	Room
+	Index     int    // index of room, starts from 0
+	Nth       int    // index of room, starts from 1
+	Total     int    // number of rooms
+	Now       string // current date and time
+	Timestamp int64  // current unix timestamp
+}
+
+// NewTemplateData creates template data of a room for current time.
+func NewTemplateData(room Room) TemplateData {
+	now := time.Now()
+	return TemplateData{
+		Room:      room,
+		Nth:       1,
+		Total:     1,
+		Now:       now.Format(DefaultTimeFormat),
+		Timestamp: now.Unix(),
+	}
+}
+
+// Funcs returns the helper functions that can be used in templates:
+//
+//	safe       - make a string safe to use as file name
+//	shellquote - quote a string for POSIX shell
+//	date       - format current time with layout
+//	lower      - convert string to lower case
+//	upper      - convert string to upper case
+//	default    - use default value if value is empty
+//	env        - get value of environment variable
+//	quality    - stream URL for quality and optional format (flv, hls)
+//	json       - encode value to JSON
+func (data TemplateData) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"safe":       SafeFileName,
+		"shellquote": ShellQuote,
+		"date": func(layout string) string {
+			return time.Now().Format(layout)
+		},
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"default": func(def string, value interface{}) interface{} {
+			if value == nil || value == "" {
+				return def
+			}
+			return value
+		},
+		"env": os.Getenv,
+		"quality": func(quality string, format ...string) string {
+			if len(format) > 0 && (format[0] == "hls" || format[0] == "m3u8") {
+				return data.HlsUrlForQuality(quality)
+			}
+			return data.FlvUrlForQuality(quality)
+		},
+		"json": func(value interface{}) (string, error) {
+			b, err := json.Marshal(value)
+			return string(b), err
+		},
+	}
+}
+
+// Execute parses text as template and executes it with data.
+func (data TemplateData) Execute(text string) (string, error) {
+	tpl, err := template.New("").Funcs(data.Funcs()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// Env returns room info as environment variables for external commands.
+func (room Room) Env() []string {
+	return []string{
+		"DYLIVE_ROOM_ID=" + room.Id,
+		"DYLIVE_DOUYIN_ID=" + room.DouyinId,
+		"DYLIVE_ROOM_NAME=" + room.Name,
+		"DYLIVE_STATUS=" + room.StatusCode.String(),
+		"DYLIVE_WEB_URL=" + room.WebUrl,
+		"DYLIVE_COVER_URL=" + room.CoverUrl,
+		"DYLIVE_STREAM_URL=" + room.StreamUrl,
+		"DYLIVE_USER_NAME=" + room.User.Name,
+		"DYLIVE_USER_PICTURE=" + room.User.Picture,
+	}
+}
+
+// SafeFileName replaces characters that are not allowed in file names on
+// common file systems with underscores.
+func SafeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// CreateFile creates new file of the name, or of the name with number
+// suffix if the file exists, for example name-1.flv, so that a stream
+// recorded or saved again does not overwrite the previous file.
+func CreateFile(name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			return file, err
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// ShellQuote quotes a string so that it is treated as a single word in POSIX
+// shell.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
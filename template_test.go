@@ -0,0 +1,99 @@
+package dylive
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSafeFileName(t *testing.T) {
+	cases := [][]string{
+		{"abc", "abc"},
+		{"a/b\\c", "a_b_c"},
+		{`<a>:"b"|c?*`, "_a___b__c__"},
+		{" .. ", "_"},
+		{"直播 1.", "直播 1"},
+	}
+	for _, c := range cases {
+		if actual := SafeFileName(c[0]); actual != c[1] {
+			t.Errorf(`SafeFileName("%s") should be "%s" instead of "%s"`, c[0], c[1], actual)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := [][]string{
+		{"abc", "'abc'"},
+		{"", "''"},
+		{"it's $HOME", `'it'\''s $HOME'`},
+	}
+	for _, c := range cases {
+		if actual := ShellQuote(c[0]); actual != c[1] {
+			t.Errorf(`ShellQuote("%s") should be "%s" instead of "%s"`, c[0], c[1], actual)
+		}
+	}
+}
+
+func TestTemplateDataExecute(t *testing.T) {
+	os.Setenv("DYLIVE_TEST", "foo")
+	data := NewTemplateData(Room{
+		Id:        "1",
+		Name:      "a/b",
+		StreamUrl: "default",
+		FlvStreamUrls: map[string]string{
+			"FULL_HD1": "http://example.com/stream_uhd.flv",
+			"HD1":      "http://example.com/stream_hd.flv",
+		},
+		User: User{Name: "O'Neil"},
+	})
+	cases := [][]string{
+		{"{{.Nth}}/{{.Total}}", "1/1"},
+		{"{{safe .Name}}", "a_b"},
+		{"{{shellquote .User.Name}}", `'O'\''Neil'`},
+		{"{{upper .Id}}{{lower \"A\"}}", "1a"},
+		{`{{default "x" .CoverUrl}}`, "x"},
+		{`{{env "DYLIVE_TEST"}}`, "foo"},
+		{`{{quality "hd"}}`, "http://example.com/stream_hd.flv"},
+		{`{{quality "hd" "hls"}}`, "default"},
+		{`{{json .User.Name}}`, `"O'Neil"`},
+	}
+	for _, c := range cases {
+		actual, err := data.Execute(c[0])
+		if err != nil {
+			t.Error(err)
+		}
+		if actual != c[1] {
+			t.Errorf(`template "%s" should output "%s" instead of "%s"`, c[0], c[1], actual)
+		}
+	}
+}
+
+func TestRoomEnv(t *testing.T) {
+	env := Room{
+		Id:         "1",
+		DouyinId:   "abc",
+		Name:       "a b",
+		StatusCode: RoomStatusLiveOn,
+		WebUrl:     "https://live.douyin.com/abc",
+		StreamUrl:  "http://example.com/stream.flv",
+		User:       User{Name: "O'Neil", Picture: "http://example.com/a.jpg"},
+	}.Env()
+	cases := [][]string{
+		{"DYLIVE_ROOM_ID", "1"},
+		{"DYLIVE_DOUYIN_ID", "abc"},
+		{"DYLIVE_ROOM_NAME", "a b"},
+		{"DYLIVE_STATUS", "live"},
+		{"DYLIVE_WEB_URL", "https://live.douyin.com/abc"},
+		{"DYLIVE_COVER_URL", ""},
+		{"DYLIVE_STREAM_URL", "http://example.com/stream.flv"},
+		{"DYLIVE_USER_NAME", "O'Neil"},
+		{"DYLIVE_USER_PICTURE", "http://example.com/a.jpg"},
+	}
+	if len(env) != len(cases) {
+		t.Fatalf("should have %d variables instead of %d", len(cases), len(env))
+	}
+	for i, c := range cases {
+		if expected := c[0] + "=" + c[1]; env[i] != expected {
+			t.Errorf("variable %d should be %q instead of %q", i, expected, env[i])
+		}
+	}
+}
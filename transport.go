@@ -0,0 +1,212 @@
+package dylive
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when requests are paused after too many
+// consecutive failures.
+var ErrCircuitOpen = errors.New("too many failed requests to Douyin, requests are paused")
+
+// HTTPClient is the client used for pages and APIs of Douyin. Streams use
+// MediaClient.
+var HTTPClient = &http.Client{
+	Transport: &Transport{
+		Rate:             2,
+		Burst:            5,
+		MaxRetries:       3,
+		MinBackoff:       500 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		BreakerThreshold: 10,
+		BreakerCooldown:  time.Minute,
+	},
+}
+
+// MediaClient is the client used for streams from CDN. It does not share
+// the rate limit and circuit breaker of HTTPClient, so that long-running
+// streams do not use up requests to Douyin and failures of CDN do not pause
+// them.
+var MediaClient = &http.Client{}
+
+// Transport is a http.RoundTripper that limits request rate, retries failed
+// requests with exponential backoff and pauses all requests after too many
+// consecutive failures. Zero values of the fields disable each feature.
+type Transport struct {
+	Base http.RoundTripper // defaults to http.DefaultTransport
+
+	Rate  float64 // requests per second
+	Burst int     // maximum number of requests at once
+
+	MaxRetries int           // retries of requests that fail with network errors, 429 or 5xx
+	MinBackoff time.Duration // wait before first retry
+	MaxBackoff time.Duration // maximum wait between retries
+
+	BreakerThreshold int           // consecutive failures before requests are paused
+	BreakerCooldown  time.Duration // how long requests are paused
+
+	mu        sync.Mutex
+	tokens    float64
+	lastToken time.Time
+	failures  int
+	openUntil time.Time
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	retryable := req.Body == nil || req.GetBody != nil
+	for attempt := 0; ; attempt++ {
+		if err := t.allow(); err != nil {
+			return nil, err
+		}
+		if err := t.wait(req.Context()); err != nil {
+			return nil, err
+		}
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		resp, err := base.RoundTrip(req)
+		failed := isTransientFailure(resp, err)
+		if err != nil && req.Context().Err() != nil {
+			return nil, err
+		}
+		t.record(failed)
+		if !failed || !retryable || attempt >= t.MaxRetries {
+			return resp, err
+		}
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 {
+				delay = after
+				if t.MaxBackoff > 0 && delay > t.MaxBackoff {
+					delay = t.MaxBackoff
+				}
+			}
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isTransientFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// allow returns ErrCircuitOpen if requests are paused. After the cooldown,
+// requests are allowed again and the next failure pauses them again.
+func (t *Transport) allow() error {
+	if t.BreakerThreshold <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Now().Before(t.openUntil) {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+func (t *Transport) record(failed bool) {
+	if t.BreakerThreshold <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !failed {
+		t.failures = 0
+		return
+	}
+	t.failures++
+	if t.failures >= t.BreakerThreshold {
+		t.openUntil = time.Now().Add(t.BreakerCooldown)
+		t.failures = t.BreakerThreshold - 1
+	}
+}
+
+// wait blocks until a token is available in the token bucket.
+func (t *Transport) wait(ctx context.Context) error {
+	if t.Rate <= 0 {
+		return nil
+	}
+	burst := float64(t.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	t.mu.Lock()
+	now := time.Now()
+	if t.lastToken.IsZero() {
+		t.tokens = burst
+	} else {
+		t.tokens += now.Sub(t.lastToken).Seconds() * t.Rate
+		if t.tokens > burst {
+			t.tokens = burst
+		}
+	}
+	t.lastToken = now
+	t.tokens--
+	var delay time.Duration
+	if t.tokens < 0 {
+		delay = time.Duration(-t.tokens / t.Rate * float64(time.Second))
+	}
+	t.mu.Unlock()
+	return sleep(ctx, delay)
+}
+
+// backoff returns exponential backoff with jitter for the attempt.
+func (t *Transport) backoff(attempt int) time.Duration {
+	d := t.MinBackoff << attempt
+	if d <= 0 || (t.MaxBackoff > 0 && d > t.MaxBackoff) {
+		d = t.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses the Retry-After header in seconds or HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,157 @@
+package dylive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type (
+	dyProfile struct {
+		Uid                    string `json:"uid"`
+		SecUid                 string `json:"secUid"`
+		UniqueId               string `json:"uniqueId"`
+		ShortId                string `json:"shortId"`
+		Nickname               string `json:"nickname"`
+		Desc                   string `json:"desc"`
+		AvatarUrl              string `json:"avatarUrl"`
+		Avatar300Url           string `json:"avatar300Url"`
+		FollowerCount          int64  `json:"followerCount"`
+		FollowingCount         int64  `json:"followingCount"`
+		CustomVerify           string `json:"customVerify"`
+		EnterpriseVerifyReason string `json:"enterpriseVerifyReason"`
+		RoomData               string `json:"roomData"` // JSON of current live stream room
+	}
+)
+
+// Key returns an identifier of the user that does not change when the user
+// changes name, which is sec_uid, uid or name, whichever is available first.
+func (user User) Key() string {
+	if user.SecUid != "" {
+		return user.SecUid
+	}
+	if user.Id != "" {
+		return user.Id
+	}
+	return user.Name
+}
+
+// IsSecUid reports whether id looks like a sec_uid instead of a Douyin ID.
+func IsSecUid(id string) bool {
+	return strings.HasPrefix(id, "MS4wLjABAAAA")
+}
+
+// GetUser gets user profile by Douyin ID (抖音号) of live stream room or by
+// sec_uid.
+func GetUser(ctx context.Context, id string) (*User, error) {
+	if !IsSecUid(id) {
+		room, err := GetRoom(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return &room.User, nil
+	}
+	profile, err := getProfile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	user := profile.user()
+	return &user, nil
+}
+
+func getProfile(ctx context.Context, secUid string) (*dyProfile, error) {
+	data, err := getPage(ctx, "https://www.douyin.com/user/"+secUid, nil)
+	if err != nil {
+		return nil, err
+	}
+	var profile dyProfile
+	if _, err := data.find("user.user", &profile); err != nil {
+		return nil, fmt.Errorf("user %s: %w", secUid, err)
+	} else if profile.SecUid == "" {
+		return nil, fmt.Errorf("user %s does not exist", secUid)
+	}
+	return &profile, nil
+}
+
+func (p dyProfile) user() User {
+	uniqueId := p.UniqueId
+	if uniqueId == "" {
+		uniqueId = p.ShortId
+	}
+	verifyReason := p.CustomVerify
+	if verifyReason == "" {
+		verifyReason = p.EnterpriseVerifyReason
+	}
+	return User{
+		Id:             p.Uid,
+		SecUid:         p.SecUid,
+		UniqueId:       uniqueId,
+		Name:           p.Nickname,
+		Picture:        p.AvatarUrl,
+		PictureMedium:  p.Avatar300Url,
+		PictureLarge:   p.Avatar300Url,
+		Signature:      p.Desc,
+		FollowerCount:  p.FollowerCount,
+		FollowingCount: p.FollowingCount,
+		Verified:       verifyReason != "",
+		VerifyReason:   verifyReason,
+	}
+}
+
+// user converts Douyin user to User, picture overrides the thumbnail if it
+// is not empty.
+func (u dyUser) user(picture string) User {
+	if picture == "" {
+		picture = u.AvatarThumb.first()
+	}
+	verifyReason := u.AuthenticationInfo.CustomVerify
+	if verifyReason == "" {
+		verifyReason = u.AuthenticationInfo.EnterpriseVerifyReason
+	}
+	return User{
+		Id:             u.IdStr,
+		SecUid:         u.SecUid,
+		UniqueId:       u.DisplayId,
+		Name:           u.Nickname,
+		Picture:        picture,
+		PictureMedium:  u.AvatarMedium.first(),
+		PictureLarge:   u.AvatarLarge.first(),
+		Signature:      u.Signature,
+		FollowerCount:  u.FollowInfo.FollowerCount,
+		FollowingCount: u.FollowInfo.FollowingCount,
+		Verified:       verifyReason != "",
+		VerifyReason:   verifyReason,
+	}
+}
+
+// merge fills empty fields of user with fields of other.
+func (user *User) merge(other User) {
+	fill := func(a *string, b string) {
+		if *a == "" {
+			*a = b
+		}
+	}
+	fill(&user.Id, other.Id)
+	fill(&user.SecUid, other.SecUid)
+	fill(&user.UniqueId, other.UniqueId)
+	fill(&user.Name, other.Name)
+	fill(&user.Picture, other.Picture)
+	fill(&user.PictureMedium, other.PictureMedium)
+	fill(&user.PictureLarge, other.PictureLarge)
+	fill(&user.Signature, other.Signature)
+	fill(&user.VerifyReason, other.VerifyReason)
+	if user.FollowerCount == 0 {
+		user.FollowerCount = other.FollowerCount
+	}
+	if user.FollowingCount == 0 {
+		user.FollowingCount = other.FollowingCount
+	}
+	user.Verified = user.Verified || other.Verified
+}
+
+func (image dyImage) first() string {
+	if len(image.UrlList) > 0 {
+		return image.UrlList[0]
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package dylive
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestUserKey(t *testing.T) {
+	cases := []struct {
+		user User
+		key  string
+	}{
+		{User{Name: "a"}, "a"},
+		{User{Id: "1", Name: "a"}, "1"},
+		{User{Id: "1", SecUid: "MS4wLjABAAAAx", Name: "a"}, "MS4wLjABAAAAx"},
+	}
+	for _, c := range cases {
+		if actual := c.user.Key(); actual != c.key {
+			t.Errorf("key should be %s instead of %s", c.key, actual)
+		}
+	}
+}
+
+func TestUserFromProfile(t *testing.T) {
+	const profile = `{"1":{"user":{"user":{"uid":"1","secUid":"MS4wLjABAAAAx","uniqueId":"abc","nickname":"A",` +
+		`"desc":"hi","avatarUrl":"a.jpg","avatar300Url":"b.jpg","followerCount":100,"followingCount":2,"customVerify":"V"}}}}`
+	html := `<script id="RENDER_DATA" type="application/json">` + url.PathEscape(profile) + `</script>`
+	var p dyProfile
+	if _, err := newPageData(html).find("user.user", &p); err != nil {
+		t.Fatal(err)
+	}
+	user := p.user()
+	expected := User{
+		Id:             "1",
+		SecUid:         "MS4wLjABAAAAx",
+		UniqueId:       "abc",
+		Name:           "A",
+		Picture:        "a.jpg",
+		PictureMedium:  "b.jpg",
+		PictureLarge:   "b.jpg",
+		Signature:      "hi",
+		FollowerCount:  100,
+		FollowingCount: 2,
+		Verified:       true,
+		VerifyReason:   "V",
+	}
+	if user != expected {
+		t.Errorf("user should be %+v instead of %+v", expected, user)
+	}
+}